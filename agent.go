@@ -0,0 +1,237 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/go-authgate/device-cli/authgate"
+	"github.com/go-authgate/device-cli/tui"
+)
+
+// envAgentSocket tells clients where the agent listens, like SSH_AUTH_SOCK.
+const envAgentSocket = "AUTHGATE_AGENT_SOCK"
+
+// defaultAgentSocket returns where the agent listens when no socket is
+// configured: under $XDG_RUNTIME_DIR, or a per-user directory in the system
+// temporary directory.
+func defaultAgentSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "authgate", "agent.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("authgate-%d", os.Getuid()), "agent.sock")
+}
+
+// cmdAgent keeps tokens in memory and serves access tokens over a Unix
+// socket until interrupted. Tokens are loaded from the token store at
+// startup; if the current client has none, a device flow is run first when a
+// terminal is attached. Refreshed tokens are kept in memory only, so the
+// agent owns the session: once it rotates a loaded refresh token, the copy in
+// the store no longer works. With -write-back, refreshed tokens that were
+// loaded from the store are saved there as well.
+func cmdAgent(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("agent", flag.ContinueOnError)
+	ahead := flags.Duration(
+		"refresh-ahead",
+		refreshAhead,
+		"Refresh tokens this long before they expire",
+	)
+	load := flags.Bool("load", true, "Load the tokens saved in the token store at startup")
+	writeBack := flags.Bool(
+		"write-back",
+		false,
+		"Save refreshed tokens that were loaded from the token store back to it",
+	)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if !noArgs("agent", flags.Args()) {
+		return exitUsage
+	}
+	socket := cmp.Or(agentSocket, defaultAgentSocket())
+
+	c := newClient()
+	c.AgentSocket = ""
+	store := &agentStore{backing: newTokenStore(), writeBack: *writeBack}
+	c.Store = store
+	c.RefreshAhead = *ahead
+	if *load {
+		loaded, err := store.load()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		if loaded > 0 {
+			fmt.Fprintf(os.Stderr, "Loaded %d token entries from %s\n", loaded, newTokenStore())
+		}
+	}
+
+	_, err := c.FreshToken(ctx, 0, nil)
+	switch {
+	case errors.Is(err, authgate.ErrLoginRequired) && isInteractive():
+		err = withDisplayer(func(d tui.Displayer) error {
+			storage, err := c.PerformDeviceFlow(ctx, d)
+			if err != nil {
+				d.Fatal(err)
+				return err
+			}
+			showDone(d, storage)
+			return nil
+		})
+		if err != nil {
+			return exitCodeFor(err)
+		}
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Warning: no usable token for client_id %s: %v\n", clientID, err)
+	}
+
+	l, err := authgate.ListenAgent(socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	fmt.Printf("%s=%s; export %s;\n", envAgentSocket, socket, envAgentSocket)
+	fmt.Fprintf(os.Stderr, "Agent listening on %s (Ctrl+C to stop)\n", socket)
+
+	if err := (&authgate.Agent{Client: c, RefreshAhead: *ahead}).Serve(ctx, l); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// agentStore keeps the agent's tokens in memory. With writeBack, entries
+// loaded from the backing store are written back to it when they change, so
+// that the refresh token saved there stays valid after the agent rotates it.
+type agentStore struct {
+	authgate.MemoryStore
+	backing   authgate.TokenStore
+	writeBack bool            // save changes to loaded entries in backing
+	loaded    map[string]bool // keys of the entries loaded from backing
+}
+
+// load copies the entries of the backing store into memory and returns how
+// many there were.
+func (s *agentStore) load() (int, error) {
+	n, err := migrateTokens(s.backing, &s.MemoryStore, false)
+	if err != nil || n == 0 || !s.writeBack {
+		return n, err
+	}
+	tokens, err := s.MemoryStore.Load()
+	if err != nil {
+		return 0, err
+	}
+	s.loaded = make(map[string]bool, len(tokens))
+	for key := range tokens {
+		s.loaded[key] = true
+	}
+	return n, nil
+}
+
+// Update applies fn in memory and writes the loaded entries it replaced or
+// removed back to the backing store. The change is kept in memory even when
+// writing it back fails, as a rotated refresh token cannot be recovered.
+func (s *agentStore) Update(fn func(tokens map[string]*TokenStorage) (bool, error)) error {
+	var writeErr error
+	err := s.MemoryStore.Update(func(tokens map[string]*TokenStorage) (bool, error) {
+		before := maps.Clone(tokens)
+		changed, err := fn(tokens)
+		if err != nil || !changed {
+			return changed, err
+		}
+		writeErr = s.saveChanged(before, tokens)
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return fmt.Errorf("failed to write tokens back to %s: %w", s.backing, writeErr)
+	}
+	return nil
+}
+
+// saveChanged saves the loaded entries that differ between before and after
+// in the backing store.
+func (s *agentStore) saveChanged(before, after map[string]*TokenStorage) error {
+	changed := make(map[string]*TokenStorage)
+	for key := range s.loaded {
+		if after[key] != before[key] {
+			changed[key] = after[key]
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	return s.backing.Update(func(saved map[string]*TokenStorage) (bool, error) {
+		for key, storage := range changed {
+			if storage == nil {
+				delete(saved, key)
+			} else {
+				saved[key] = storage
+			}
+		}
+		return true, nil
+	})
+}
+
+// agentEntry returns the agent's entry for the current client, without its
+// tokens, or nil when no agent is configured or it holds none.
+func agentEntry(ctx context.Context) *TokenStorage {
+	if agentSocket == "" {
+		return nil
+	}
+	entries, err := newClient().AgentStatus(ctx)
+	if err != nil {
+		return nil
+	}
+	key := authgate.TokenKey(serverURL, clientID)
+	for _, entry := range entries {
+		if authgate.TokenKey(entry.Issuer, entry.ClientID) == key {
+			return entry
+		}
+	}
+	return nil
+}
+
+// agentLogoutAll asks the agent to revoke and forget every entry it holds,
+// and returns removed extended by the entries it removed that are not
+// already listed. Entries the agent could not log out are kept, and their
+// errors are joined in the returned error.
+func agentLogoutAll(ctx context.Context, removed []*TokenStorage) ([]*TokenStorage, error) {
+	if agentSocket == "" {
+		return removed, nil
+	}
+	entries, err := newClient().AgentStatus(ctx)
+	if errors.Is(err, authgate.ErrAgentUnavailable) {
+		return removed, nil
+	}
+	if err != nil {
+		return removed, err
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		c := newClient()
+		c.ServerURL, c.ClientID = entry.Issuer, entry.ClientID
+		ok, err := c.AgentLogout(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("client_id %s: %w", entry.ClientID, err))
+			continue
+		}
+		key := authgate.TokenKey(entry.Issuer, entry.ClientID)
+		listed := slices.ContainsFunc(removed, func(s *TokenStorage) bool {
+			return authgate.TokenKey(s.Issuer, s.ClientID) == key
+		})
+		if ok && !listed {
+			removed = append(removed, entry)
+		}
+	}
+	return removed, errors.Join(errs...)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-authgate/device-cli/authgate"
+)
+
+func TestAgentStore_KeepsTokensInMemory(t *testing.T) {
+	backing := &authgate.MemoryStore{}
+	err := backing.Update(func(tokens map[string]*TokenStorage) (bool, error) {
+		tokens["loaded"] = &TokenStorage{RefreshToken: "refresh-1"}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to seed backing store: %v", err)
+	}
+	store := &agentStore{backing: backing}
+	if n, err := store.load(); err != nil || n != 1 {
+		t.Fatalf("load() = %d, %v; want 1, nil", n, err)
+	}
+
+	err = store.Update(func(tokens map[string]*TokenStorage) (bool, error) {
+		tokens["loaded"] = &TokenStorage{RefreshToken: "refresh-2"}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if saved, _ := backing.Load(); saved["loaded"].RefreshToken != "refresh-1" {
+		t.Errorf("backing entry = %+v, want it untouched", saved["loaded"])
+	}
+}
+
+func TestAgentStore_WritesBackLoadedEntries(t *testing.T) {
+	backing := &authgate.MemoryStore{}
+	err := backing.Update(func(tokens map[string]*TokenStorage) (bool, error) {
+		tokens["loaded"] = &TokenStorage{RefreshToken: "refresh-1"}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to seed backing store: %v", err)
+	}
+	store := &agentStore{backing: backing, writeBack: true}
+	if n, err := store.load(); err != nil || n != 1 {
+		t.Fatalf("load() = %d, %v; want 1, nil", n, err)
+	}
+
+	err = store.Update(func(tokens map[string]*TokenStorage) (bool, error) {
+		tokens["loaded"] = &TokenStorage{RefreshToken: "refresh-2"}
+		tokens["new"] = &TokenStorage{RefreshToken: "agent-only"}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	saved, _ := backing.Load()
+	if got := saved["loaded"]; got == nil || got.RefreshToken != "refresh-2" {
+		t.Errorf("backing entry = %+v, want rotated refresh-2", got)
+	}
+	if _, ok := saved["new"]; ok {
+		t.Error("entry from the agent's own login was written to the backing store")
+	}
+
+	err = store.Update(func(tokens map[string]*TokenStorage) (bool, error) {
+		delete(tokens, "loaded")
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if saved, _ := backing.Load(); len(saved) != 0 {
+		t.Errorf("backing store holds %d entries after logout, want 0", len(saved))
+	}
+}
@@ -0,0 +1,337 @@
+package authgate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Operations of the agent protocol.
+const (
+	AgentOpGetToken = "get-token"
+	AgentOpStatus   = "status"
+	AgentOpLogout   = "logout"
+)
+
+const (
+	// agentIOTimeout bounds connecting to an agent and passing a request or
+	// response, which are local and either go through at once or not at all.
+	agentIOTimeout = 2 * time.Second
+	// agentRequestTimeout bounds one agent request, which may include a
+	// refresh or revocation round trip.
+	agentRequestTimeout = refreshTokenTimeout + revocationTimeout
+	// agentCheckInterval is how often an Agent looks for tokens to refresh.
+	agentCheckInterval = 10 * time.Second
+)
+
+// ErrAgentUnavailable is returned when no agent is listening on
+// Client.AgentSocket.
+var ErrAgentUnavailable = errors.New("agent is not running")
+
+// AgentRequest is sent by a client to an agent. Each connection carries one
+// JSON request followed by one JSON response.
+type AgentRequest struct {
+	Op        string   `json:"op"`
+	ServerURL string   `json:"server_url,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	// MinValid is how long, in seconds, a returned token must remain valid.
+	MinValid int `json:"min_valid,omitempty"`
+	// Rejected is an access token a resource server rejected. The agent
+	// refreshes it unless it already holds a different one.
+	Rejected string `json:"rejected,omitempty"`
+}
+
+// AgentResponse is an agent's answer to an AgentRequest. Refresh tokens never
+// leave the agent: Token carries only the access token and its metadata, and
+// Tokens, the entries listed by status, carry no tokens at all.
+type AgentResponse struct {
+	Error   string          `json:"error,omitempty"`
+	Token   *TokenStorage   `json:"token,omitempty"`
+	Tokens  []*TokenStorage `json:"tokens,omitempty"`
+	Removed bool            `json:"removed,omitempty"`
+}
+
+// Agent keeps tokens in memory and hands access tokens to other processes
+// over a Unix socket, much like ssh-agent. It refreshes the tokens it holds
+// ahead of expiry, so refresh tokens stay in the agent's memory and clients
+// need neither the token file nor its lock.
+type Agent struct {
+	// Client is used to refresh and revoke tokens; its ServerURL and
+	// ClientID are replaced by those of each entry. Its Store holds the
+	// agent's tokens and is normally a MemoryStore.
+	Client *Client
+	// RefreshAhead is how long before expiry tokens are refreshed.
+	// Client.RefreshAhead is used when zero.
+	RefreshAhead time.Duration
+}
+
+// ListenAgent creates the agent socket at path, readable and writable by its
+// owner only. The parent directory is created with mode 0700 if missing; an
+// existing one must be owned by the current user with mode 0700 and must not
+// be a symlink. A socket left behind by an agent that is no longer running is
+// replaced.
+func ListenAgent(path string) (net.Listener, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create agent socket directory: %w", err)
+	}
+	if err := checkSocketDir(dir); err != nil {
+		return nil, err
+	}
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, agentIOTimeout); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("an agent is already listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale agent socket: %w", err)
+		}
+	}
+
+	l, err := listenUnix(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to restrict agent socket: %w", err)
+	}
+	return l, nil
+}
+
+// Serve answers requests on l and refreshes tokens ahead of expiry until ctx
+// is done, then closes l. It returns nil when stopped by ctx.
+func (a *Agent) Serve(ctx context.Context, l net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	wg.Go(func() {
+		<-ctx.Done()
+		l.Close()
+	})
+	wg.Go(func() { a.refreshLoop(ctx) })
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Go(func() { a.serveConn(ctx, conn) })
+	}
+}
+
+// serveConn answers the single request on conn.
+func (a *Agent) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(agentIOTimeout))
+	var req AgentRequest
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, agentRequestTimeout)
+	defer cancel()
+	resp := a.handle(ctx, &req)
+
+	_ = conn.SetWriteDeadline(time.Now().Add(agentIOTimeout))
+	_ = json.NewEncoder(conn).Encode(resp)
+}
+
+// handle performs req and reports any failure in the response.
+func (a *Agent) handle(ctx context.Context, req *AgentRequest) *AgentResponse {
+	c := a.clientFor(req.ServerURL, req.ClientID)
+	c.Scopes = req.Scopes
+
+	var (
+		resp AgentResponse
+		err  error
+	)
+	switch req.Op {
+	case AgentOpGetToken:
+		var storage *TokenStorage
+		if req.Rejected != "" {
+			storage, err = c.refreshIfUnchanged(ctx, req.Rejected)
+		} else {
+			storage, err = c.FreshToken(ctx, time.Duration(req.MinValid)*time.Second, nil)
+		}
+		if err == nil {
+			resp.Token = withoutRefreshToken(storage)
+		}
+	case AgentOpStatus:
+		resp.Tokens, err = a.status()
+	case AgentOpLogout:
+		resp.Removed, err = c.Logout(ctx)
+	default:
+		err = fmt.Errorf("unknown operation %q", req.Op)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return &resp
+}
+
+// clientFor returns a copy of a.Client for serverURL and clientID.
+func (a *Agent) clientFor(serverURL, clientID string) *Client {
+	c := *a.Client.forIssuer(normalizeServerURL(serverURL))
+	c.ClientID = clientID
+	c.AgentSocket = ""
+	return &c
+}
+
+// status lists the agent's entries without their tokens, ordered by issuer
+// and client ID.
+func (a *Agent) status() ([]*TokenStorage, error) {
+	tokens, err := a.Client.store().Load()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*TokenStorage, 0, len(tokens))
+	for _, storage := range tokens {
+		entry := *storage
+		entry.AccessToken, entry.RefreshToken, entry.IDToken = "", "", ""
+		entries = append(entries, &entry)
+	}
+	sortByIssuer(entries)
+	return entries, nil
+}
+
+// refreshLoop refreshes tokens that expire within the refresh-ahead window
+// until ctx is done. A refresh token the server rejected is not tried again.
+func (a *Agent) refreshLoop(ctx context.Context) {
+	ahead := a.RefreshAhead
+	if ahead <= 0 {
+		ahead = a.Client.refreshAhead()
+	}
+	rejected := make(map[string]string) // key -> refresh token the server rejected
+
+	ticker := time.NewTicker(agentCheckInterval)
+	defer ticker.Stop()
+	for {
+		tokens, _ := a.Client.store().Load()
+		for key, storage := range tokens {
+			if storage.RefreshToken == "" || rejected[key] == storage.RefreshToken ||
+				storage.Valid(ahead) {
+				continue
+			}
+			c := a.clientFor(storage.Issuer, storage.ClientID)
+			_, err := c.RefreshAccessToken(ctx, storage.RefreshToken, noopDisplayer{})
+			if errors.Is(err, ErrRefreshTokenExpired) {
+				rejected[key] = storage.RefreshToken
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// withoutRefreshToken returns a copy of storage without its refresh token.
+func withoutRefreshToken(storage *TokenStorage) *TokenStorage {
+	out := *storage
+	out.RefreshToken = ""
+	return &out
+}
+
+// AgentStatus lists the entries held by the agent at c.AgentSocket, without
+// their tokens.
+func (c *Client) AgentStatus(ctx context.Context) ([]*TokenStorage, error) {
+	resp, err := c.callAgent(ctx, &AgentRequest{Op: AgentOpStatus})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Tokens, nil
+}
+
+// AgentLogout asks the agent at c.AgentSocket to revoke and forget the tokens
+// it holds for c.ServerURL and c.ClientID, reporting whether it held any.
+func (c *Client) AgentLogout(ctx context.Context) (bool, error) {
+	resp, err := c.callAgent(ctx, &AgentRequest{
+		Op:        AgentOpLogout,
+		ServerURL: c.issuer(),
+		ClientID:  c.ClientID,
+	})
+	if err != nil {
+		return false, err
+	}
+	return resp.Removed, nil
+}
+
+// agentToken asks the agent at c.AgentSocket for an access token that remains
+// valid for longer than minValid, or for a replacement of rejected when it is
+// not empty.
+func (c *Client) agentToken(
+	ctx context.Context,
+	minValid time.Duration,
+	rejected string,
+) (*TokenStorage, error) {
+	resp, err := c.callAgent(ctx, &AgentRequest{
+		Op:        AgentOpGetToken,
+		ServerURL: c.issuer(),
+		ClientID:  c.ClientID,
+		Scopes:    c.scopes(),
+		MinValid:  int(minValid.Round(time.Second) / time.Second),
+		Rejected:  rejected,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Token == nil {
+		return nil, errors.New("agent returned no token")
+	}
+	return resp.Token, nil
+}
+
+// callAgent sends req to the agent at c.AgentSocket and returns its response.
+// An error reported by the agent is returned as an error.
+func (c *Client) callAgent(ctx context.Context, req *AgentRequest) (*AgentResponse, error) {
+	if c.AgentSocket == "" {
+		return nil, fmt.Errorf("%w: no agent socket configured", ErrAgentUnavailable)
+	}
+	dialer := net.Dialer{Timeout: agentIOTimeout}
+	conn, err := dialer.DialContext(ctx, "unix", c.AgentSocket)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAgentUnavailable, err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(agentRequestTimeout + 2*agentIOTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send agent request: %w", err)
+	}
+	var resp AgentResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read agent response: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("agent: %s", resp.Error)
+	}
+	return &resp, nil
+}
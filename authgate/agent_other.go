@@ -0,0 +1,27 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package authgate
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// checkSocketDir refuses an agent socket directory that is a symlink.
+// Ownership cannot be checked on this platform.
+func checkSocketDir(dir string) error {
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to inspect agent socket directory: %w", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("agent socket directory %s is not a directory", dir)
+	}
+	return nil
+}
+
+// listenUnix listens on the socket path.
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,192 @@
+package authgate
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startAgent serves an agent for server on a socket in a temporary
+// directory until the test ends. It returns the agent's client, whose
+// MemoryStore holds the agent's tokens, and the socket path.
+func startAgent(t *testing.T, serverURL string, ahead time.Duration) (*Client, string) {
+	t.Helper()
+
+	c := newTestClient(t)
+	c.ServerURL = serverURL
+	c.Store = &MemoryStore{}
+	socket := filepath.Join(t.TempDir(), "agent", "agent.sock")
+
+	l, err := ListenAgent(socket)
+	if err != nil {
+		t.Fatalf("ListenAgent() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- (&Agent{Client: c, RefreshAhead: ahead}).Serve(ctx, l)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	})
+	return c, socket
+}
+
+func TestAgent_ServesTokenWithoutStore(t *testing.T) {
+	var refreshCalls atomic.Int32
+	server := newRotatingServer(t, &refreshCalls, 0)
+	agentClient, socket := startAgent(t, server.URL, time.Minute)
+	if err := agentClient.SaveTokens(&TokenStorage{
+		AccessToken:  "agent-access-token",
+		RefreshToken: "initial-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("SaveTokens() error = %v", err)
+	}
+
+	fi, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("Stat(socket) error = %v", err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0o600 {
+		t.Errorf("socket mode = %v, want 0600", perm)
+	}
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	c.AgentSocket = socket
+	storage, err := c.FreshToken(context.Background(), DefaultRefreshAhead, nil)
+	if err != nil {
+		t.Fatalf("FreshToken() error = %v", err)
+	}
+	if storage.AccessToken != "agent-access-token" {
+		t.Errorf("AccessToken = %q, want agent-access-token", storage.AccessToken)
+	}
+	if storage.RefreshToken != "" {
+		t.Errorf("agent handed out refresh token %q", storage.RefreshToken)
+	}
+	if _, err := os.Stat(c.TokenFile); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("token file was touched: %v", err)
+	}
+	if got := refreshCalls.Load(); got != 0 {
+		t.Errorf("refresh calls = %d, want 0", got)
+	}
+
+	// A token the resource server rejected is replaced by the agent.
+	storage, err = c.agentToken(context.Background(), 0, "agent-access-token")
+	if err != nil {
+		t.Fatalf("agentToken() error = %v", err)
+	}
+	if storage.AccessToken != "rotated-access-token-1" {
+		t.Errorf("AccessToken = %q, want rotated-access-token-1", storage.AccessToken)
+	}
+}
+
+func TestAgent_RefreshesAheadOfExpiry(t *testing.T) {
+	var refreshCalls atomic.Int32
+	server := newRotatingServer(t, &refreshCalls, 0)
+	agentClient, socket := startAgent(t, server.URL, time.Minute)
+	if err := agentClient.SaveTokens(&TokenStorage{
+		AccessToken:  "initial-access-token",
+		RefreshToken: "initial-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(30 * time.Second),
+	}); err != nil {
+		t.Fatalf("SaveTokens() error = %v", err)
+	}
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	c.AgentSocket = socket
+
+	deadline := time.Now().Add(agentCheckInterval + 5*time.Second)
+	for refreshCalls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got := refreshCalls.Load(); got != 1 {
+		t.Fatalf("refresh calls = %d, want 1", got)
+	}
+
+	entries, err := c.AgentStatus(context.Background())
+	if err != nil {
+		t.Fatalf("AgentStatus() error = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("AgentStatus() returned %d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.AccessToken != "" || entry.RefreshToken != "" {
+		t.Errorf("status entry carries tokens: %+v", entry)
+	}
+	if time.Until(entry.ExpiresAt) < 30*time.Minute {
+		t.Errorf("ExpiresAt = %v, want about an hour from now", entry.ExpiresAt)
+	}
+}
+
+func TestAgent_Logout(t *testing.T) {
+	agentClient, socket := startAgent(t, "http://localhost:8080", time.Minute)
+	// Without a refresh token or a valid access token there is nothing to
+	// revoke, so logout does not contact the server.
+	if err := agentClient.SaveTokens(&TokenStorage{
+		AccessToken: "expired-access-token",
+		TokenType:   "Bearer",
+		ExpiresAt:   time.Now().Add(-time.Minute),
+	}); err != nil {
+		t.Fatalf("SaveTokens() error = %v", err)
+	}
+
+	c := newTestClient(t)
+	c.AgentSocket = socket
+	removed, err := c.AgentLogout(context.Background())
+	if err != nil {
+		t.Fatalf("AgentLogout() error = %v", err)
+	}
+	if !removed {
+		t.Error("AgentLogout() removed = false, want true")
+	}
+
+	if _, err := c.FreshToken(context.Background(), 0, nil); !errors.Is(err, ErrLoginRequired) {
+		t.Errorf("FreshToken() error = %v, want ErrLoginRequired", err)
+	}
+}
+
+func TestListenAgent_Socket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "agent", "agent.sock")
+
+	l, err := ListenAgent(socket)
+	if err != nil {
+		t.Fatalf("ListenAgent() error = %v", err)
+	}
+	if _, err := ListenAgent(socket); err == nil ||
+		!strings.Contains(err.Error(), "already listening") {
+		t.Errorf("second ListenAgent() error = %v, want already listening", err)
+	}
+
+	// Leave the socket file behind, as a crashed agent would.
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	l, err = ListenAgent(socket)
+	if err != nil {
+		t.Fatalf("ListenAgent() over a stale socket error = %v", err)
+	}
+	l.Close()
+
+	notSocket := filepath.Join(filepath.Dir(socket), "file")
+	if err := os.WriteFile(notSocket, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ListenAgent(notSocket); err == nil {
+		t.Error("ListenAgent() replaced a regular file")
+	}
+}
@@ -0,0 +1,41 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package authgate
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkSocketDir refuses an agent socket directory that another user could
+// have prepared: it must be a real directory, not a symlink, owned by the
+// current user and closed to everyone else.
+func checkSocketDir(dir string) error {
+	var st unix.Stat_t
+	if err := unix.Lstat(dir, &st); err != nil {
+		return fmt.Errorf("failed to inspect agent socket directory: %w", err)
+	}
+	switch {
+	case st.Mode&unix.S_IFMT != unix.S_IFDIR:
+		return fmt.Errorf("agent socket directory %s is not a directory", dir)
+	case int(st.Uid) != os.Getuid():
+		return fmt.Errorf("agent socket directory %s is owned by uid %d", dir, st.Uid)
+	case st.Mode&0o077 != 0:
+		return fmt.Errorf(
+			"agent socket directory %s has mode %#o, want 0700",
+			dir, st.Mode&0o777,
+		)
+	}
+	return nil
+}
+
+// listenUnix listens on the socket path with a umask that leaves it
+// accessible to its owner only from the moment it is created.
+func listenUnix(path string) (net.Listener, error) {
+	old := unix.Umask(0o177)
+	defer unix.Umask(old)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,44 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package authgate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenAgent_RejectsUnsafeDirectory(t *testing.T) {
+	open := filepath.Join(t.TempDir(), "open")
+	if err := os.Mkdir(open, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(open, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ListenAgent(filepath.Join(open, "agent.sock")); err == nil {
+		t.Error("ListenAgent() accepted a directory with mode 0755")
+	}
+
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(t.TempDir(), link); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ListenAgent(filepath.Join(link, "agent.sock")); err == nil {
+		t.Error("ListenAgent() accepted a symlinked directory")
+	}
+
+	if os.Getuid() != 0 {
+		t.Skip("changing a directory's owner needs root")
+	}
+	foreign := filepath.Join(t.TempDir(), "foreign")
+	if err := os.Mkdir(foreign, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(foreign, 65534, 65534); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ListenAgent(filepath.Join(foreign, "agent.sock")); err == nil {
+		t.Error("ListenAgent() accepted a directory owned by another user")
+	}
+}
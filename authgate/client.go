@@ -0,0 +1,226 @@
+// Package authgate implements the AuthGate OAuth 2.0 device authorization flow,
+// token storage and refresh so that Go programs can share the CLI's token file.
+//
+// A Client is configured with the server URL, client ID and token file path.
+// Its TokenSource method returns an oauth2.TokenSource that loads tokens from
+// the file, refreshes them when they expire and falls back to a device flow.
+package authgate
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	retry "github.com/appleboy/go-httpretry"
+)
+
+// Timeout configuration for different operations
+const (
+	deviceCodeRequestTimeout = 10 * time.Second
+	tokenExchangeTimeout     = 5 * time.Second
+	tokenVerificationTimeout = 10 * time.Second
+	refreshTokenTimeout      = 10 * time.Second
+	revocationTimeout        = 10 * time.Second
+
+	// refreshLockWait bounds how long a refresh waits for another process
+	// that holds the token file lock.
+	refreshLockWait = 30 * time.Second
+)
+
+// ErrRefreshTokenExpired indicates that the refresh token has expired or is invalid
+var ErrRefreshTokenExpired = errors.New("refresh token expired or invalid")
+
+// ErrNoTokens indicates that the token file has no entry for the current client
+var ErrNoTokens = errors.New("no tokens found")
+
+// ErrLoginRequired indicates that no usable token exists and a device flow
+// could not be started because no Displayer was provided.
+var ErrLoginRequired = errors.New("login required")
+
+// ErrorResponse is an OAuth 2.0 error response body.
+type ErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Displayer receives progress events from the device flow and token storage.
+// tui.Displayer implementations satisfy it.
+type Displayer interface {
+	DeviceCodeReady(userCode, verifyURI, verifyURIComplete string, expiry time.Time)
+	WaitingForAuth()
+	PollSlowDown(newInterval time.Duration)
+	AuthSuccess()
+	TokenSaved(path string)
+	TokenSaveFailed(err error)
+	IDTokenRejected(err error)
+}
+
+// Client performs OAuth operations against one AuthGate server for one client.
+type Client struct {
+	// ServerURL is the base URL of the AuthGate server, e.g. https://auth.example.com.
+	ServerURL string
+	// ClientID is the OAuth client ID registered with the server.
+	ClientID string
+	// TokenFile is the path of the token file shared with the CLI.
+	TokenFile string
+	// Store keeps the saved tokens. A FileStore for TokenFile is used when nil.
+	Store TokenStore
+	// AgentSocket is the Unix socket of an Agent to ask for tokens before
+	// the store is read. No agent is used when empty.
+	AgentSocket string
+	// HTTPClient sends all requests. A retrying client with TLS 1.2+ is used when nil.
+	HTTPClient *retry.Client
+	// Scopes are requested in the device flow. Saved tokens that were granted
+	// fewer scopes are replaced by a new device flow. Defaults to "read write".
+	// With the "openid" scope, the ID token is verified and saved as well.
+	Scopes []string
+
+	// Metadata overrides the server endpoints. When nil and Discovery is set,
+	// endpoints are discovered from the server's well-known metadata.
+	// Endpoints that are not known fall back to the default AuthGate paths.
+	Metadata *Metadata
+	// Discovery enables OpenID Connect / RFC 8414 metadata discovery.
+	Discovery bool
+	// MetadataCacheFile caches discovered metadata on disk when non-empty.
+	MetadataCacheFile string
+	// JWKSCacheFile caches the server's ID token signing keys on disk when
+	// non-empty. Keys are always cached in memory.
+	JWKSCacheFile string
+	// RefreshAhead is how long before expiry saved tokens stop counting as
+	// valid and are refreshed. DefaultRefreshAhead is used when zero.
+	RefreshAhead time.Duration
+}
+
+// defaultScopes are requested when Client.Scopes is empty.
+var defaultScopes = []string{"read", "write"}
+
+// scopes returns the scopes to request.
+func (c *Client) scopes() []string {
+	if len(c.Scopes) == 0 {
+		return defaultScopes
+	}
+	return c.Scopes
+}
+
+// NewHTTPClient returns the retrying HTTP client used by the CLI: TLS 1.2 or
+// newer, pooled connections and exponential backoff for transient failures.
+func NewHTTPClient() (*retry.Client, error) {
+	baseHTTPClient := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+			},
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+			DisableKeepAlives:   false,
+		},
+	}
+
+	// Wrap with retry logic using go-httpretry
+	return retry.NewBackgroundClient(
+		retry.WithHTTPClient(baseHTTPClient),
+	)
+}
+
+// defaultHTTPClient is shared by clients that do not set HTTPClient.
+var defaultHTTPClient = sync.OnceValues(NewHTTPClient)
+
+// httpClient returns c.HTTPClient or the shared default client.
+func (c *Client) httpClient() (*retry.Client, error) {
+	if c.HTTPClient != nil {
+		return c.HTTPClient, nil
+	}
+	return defaultHTTPClient()
+}
+
+// do sends req through the retrying HTTP client.
+func (c *Client) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	hc, err := c.httpClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+	return hc.DoWithContext(ctx, req)
+}
+
+// serverClockSkew estimates how far the server's clock is ahead of the local
+// clock from the Date header of a response received at received. The header
+// has a resolution of one second, so smaller differences are reported as
+// zero, as is a missing or malformed header.
+func serverClockSkew(header http.Header, received time.Time) time.Duration {
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return 0
+	}
+	skew := date.Sub(received.Truncate(time.Second))
+	if skew.Abs() <= time.Second {
+		return 0
+	}
+	return skew
+}
+
+// validateTokenResponse validates the OAuth token response
+func validateTokenResponse(accessToken, tokenType string, expiresIn int) error {
+	if accessToken == "" {
+		return errors.New("access_token is empty")
+	}
+
+	if len(accessToken) < 10 {
+		return fmt.Errorf("access_token is too short (length: %d)", len(accessToken))
+	}
+
+	if expiresIn <= 0 {
+		return fmt.Errorf("expires_in must be positive, got: %d", expiresIn)
+	}
+
+	// Token type is optional in OAuth 2.0, but if present, should be "Bearer"
+	if tokenType != "" && tokenType != "Bearer" {
+		return fmt.Errorf("unexpected token_type: %s (expected Bearer)", tokenType)
+	}
+
+	return nil
+}
+
+// TokenInfo calls the AuthGate /oauth/tokeninfo endpoint with accessToken and
+// returns the raw response body.
+func (c *Client) TokenInfo(ctx context.Context, accessToken string) (string, error) {
+	// Create request with timeout
+	reqCtx, cancel := context.WithTimeout(ctx, tokenVerificationTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(
+		reqCtx, http.MethodGet, c.ServerURL+"/oauth/tokeninfo", nil,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	// Execute request with retry logic
+	resp, err := c.do(reqCtx, req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ErrorResponse
+		if err := json.Unmarshal(body, &errResp); err != nil {
+			return "", fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+		}
+		return "", fmt.Errorf("%s: %s", errResp.Error, errResp.ErrorDescription)
+	}
+
+	return string(body), nil
+}
@@ -0,0 +1,143 @@
+package authgate
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	retry "github.com/appleboy/go-httpretry"
+)
+
+// newTestClient returns a Client with a fresh token file and a retrying HTTP client.
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+
+	hc, err := retry.NewClient()
+	if err != nil {
+		panic(fmt.Sprintf("failed to create retry client: %v", err))
+	}
+	return &Client{
+		ServerURL:  "http://localhost:8080",
+		ClientID:   "test-client",
+		TokenFile:  filepath.Join(t.TempDir(), "tokens.json"),
+		HTTPClient: hc,
+	}
+}
+
+func TestValidateTokenResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		accessToken string
+		tokenType   string
+		expiresIn   int
+		wantErr     bool
+		errContains string
+	}{
+		{
+			name:        "valid token response",
+			accessToken: "valid-access-token-123456",
+			tokenType:   "Bearer",
+			expiresIn:   3600,
+			wantErr:     false,
+		},
+		{
+			name:        "valid token with empty type (optional field)",
+			accessToken: "valid-access-token-123456",
+			tokenType:   "",
+			expiresIn:   3600,
+			wantErr:     false,
+		},
+		{
+			name:        "empty access token",
+			accessToken: "",
+			tokenType:   "Bearer",
+			expiresIn:   3600,
+			wantErr:     true,
+			errContains: "access_token is empty",
+		},
+		{
+			name:        "access token too short",
+			accessToken: "short",
+			tokenType:   "Bearer",
+			expiresIn:   3600,
+			wantErr:     true,
+			errContains: "access_token is too short",
+		},
+		{
+			name:        "zero expires_in",
+			accessToken: "valid-access-token-123456",
+			tokenType:   "Bearer",
+			expiresIn:   0,
+			wantErr:     true,
+			errContains: "expires_in must be positive",
+		},
+		{
+			name:        "negative expires_in",
+			accessToken: "valid-access-token-123456",
+			tokenType:   "Bearer",
+			expiresIn:   -3600,
+			wantErr:     true,
+			errContains: "expires_in must be positive",
+		},
+		{
+			name:        "invalid token type",
+			accessToken: "valid-access-token-123456",
+			tokenType:   "Basic",
+			expiresIn:   3600,
+			wantErr:     true,
+			errContains: "unexpected token_type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTokenResponse(tt.accessToken, tt.tokenType, tt.expiresIn)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("validateTokenResponse() expected error but got nil")
+					return
+				}
+				if tt.errContains != "" && !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf(
+						"validateTokenResponse() error = %v, want error containing %q",
+						err,
+						tt.errContains,
+					)
+				}
+			} else if err != nil {
+				t.Errorf("validateTokenResponse() unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestServerClockSkew(t *testing.T) {
+	received := time.Date(2026, 1, 2, 15, 4, 5, 600*int(time.Millisecond), time.UTC)
+	tests := []struct {
+		name string
+		date string
+		want time.Duration
+	}{
+		{"in sync", "Fri, 02 Jan 2026 15:04:05 GMT", 0},
+		{"within resolution", "Fri, 02 Jan 2026 15:04:04 GMT", 0},
+		{"server ahead", "Fri, 02 Jan 2026 15:09:05 GMT", 5 * time.Minute},
+		{"server behind", "Fri, 02 Jan 2026 15:03:35 GMT", -30 * time.Second},
+		{"missing", "", 0},
+		{"malformed", "yesterday", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.date != "" {
+				header.Set("Date", tt.date)
+			}
+			if got := serverClockSkew(header, received); got != tt.want {
+				t.Errorf("serverClockSkew(%q) = %v, want %v", tt.date, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package authgate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// RequestDeviceCode requests a device code from the OAuth server with retry logic
+func (c *Client) RequestDeviceCode(ctx context.Context) (*oauth2.DeviceAuthResponse, error) {
+	return c.requestDeviceCode(ctx, "")
+}
+
+// requestDeviceCode requests a device code, sending nonce for the ID token
+// when it is not empty.
+func (c *Client) requestDeviceCode(
+	ctx context.Context,
+	nonce string,
+) (*oauth2.DeviceAuthResponse, error) {
+	// Create request with timeout
+	reqCtx, cancel := context.WithTimeout(ctx, deviceCodeRequestTimeout)
+	defer cancel()
+
+	data := url.Values{}
+	data.Set("client_id", c.ClientID)
+	data.Set("scope", strings.Join(c.scopes(), " "))
+	if nonce != "" {
+		data.Set("nonce", nonce)
+	}
+
+	req, err := http.NewRequestWithContext(
+		reqCtx,
+		http.MethodPost,
+		c.endpoints(ctx).DeviceAuthorizationEndpoint,
+		strings.NewReader(data.Encode()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create device code request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Execute request with retry logic
+	resp, err := c.do(reqCtx, req)
+	if err != nil {
+		return nil, fmt.Errorf("device code request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(
+			"device code request failed with status %d: %s",
+			resp.StatusCode,
+			string(body),
+		)
+	}
+
+	// Parse response
+	var deviceResp struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		ExpiresIn               int    `json:"expires_in"`
+		Interval                int    `json:"interval"`
+	}
+
+	if err := json.Unmarshal(body, &deviceResp); err != nil {
+		return nil, fmt.Errorf("failed to parse device code response: %w", err)
+	}
+
+	return &oauth2.DeviceAuthResponse{
+		DeviceCode:              deviceResp.DeviceCode,
+		UserCode:                deviceResp.UserCode,
+		VerificationURI:         deviceResp.VerificationURI,
+		VerificationURIComplete: deviceResp.VerificationURIComplete,
+		Expiry:                  time.Now().Add(time.Duration(deviceResp.ExpiresIn) * time.Second),
+		Interval:                int64(deviceResp.Interval),
+	}, nil
+}
+
+// PerformDeviceFlow performs the OAuth device authorization flow and saves
+// the resulting tokens, reporting progress through d. With the openid scope,
+// an ID token that is missing or fails verification is reported to d and the
+// tokens are saved without it.
+func (c *Client) PerformDeviceFlow(ctx context.Context, d Displayer) (*TokenStorage, error) {
+	endpoints := c.endpoints(ctx)
+	config := &oauth2.Config{
+		ClientID: c.ClientID,
+		Endpoint: oauth2.Endpoint{
+			DeviceAuthURL: endpoints.DeviceAuthorizationEndpoint,
+			TokenURL:      endpoints.TokenEndpoint,
+		},
+		Scopes: c.scopes(),
+	}
+
+	// The nonce ties the ID token to this flow on servers that echo it
+	var nonce string
+	if c.requestsOpenID() {
+		nonce = newNonce()
+	}
+
+	// Step 1: Request device code (with retry logic)
+	deviceAuth, err := c.requestDeviceCode(ctx, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("device code request failed: %w", err)
+	}
+
+	d.DeviceCodeReady(
+		deviceAuth.UserCode,
+		deviceAuth.VerificationURI,
+		deviceAuth.VerificationURIComplete,
+		deviceAuth.Expiry,
+	)
+
+	// Step 2: Poll for token
+	d.WaitingForAuth()
+	token, err := c.pollForTokenWithProgress(ctx, config, deviceAuth, d)
+	if err != nil {
+		return nil, fmt.Errorf("token poll failed: %w", err)
+	}
+
+	d.AuthSuccess()
+
+	skew, _ := token.Extra("clock_skew").(time.Duration)
+	// An ID token that is missing or fails verification is reported and not
+	// saved, as on refresh; the access and refresh tokens are still usable.
+	idToken, _ := token.Extra("id_token").(string)
+	if c.requestsOpenID() {
+		if idToken == "" {
+			d.IDTokenRejected(fmt.Errorf("%w: the server returned none for the openid scope",
+				ErrInvalidIDToken))
+		} else if _, err := c.VerifyIDToken(ctx, idToken, nonce, skew); err != nil {
+			d.IDTokenRejected(err)
+			idToken = ""
+		}
+	}
+
+	// An omitted scope means the requested scopes were granted (RFC 6749 5.1)
+	scope, _ := token.Extra("scope").(string)
+	if scope == "" {
+		scope = strings.Join(c.scopes(), " ")
+	}
+
+	// Convert to TokenStorage and save, with the expiry on the server's clock
+	storage := &TokenStorage{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		TokenType:    token.Type(),
+		ExpiresAt:    token.Expiry.Add(skew),
+		ClientID:     c.ClientID,
+		Issuer:       c.issuer(),
+		Scope:        scope,
+		IDToken:      idToken,
+		ClockSkew:    skew,
+	}
+
+	if err := c.SaveTokens(storage); err != nil {
+		d.TokenSaveFailed(err)
+	} else {
+		d.TokenSaved(c.store().String())
+	}
+
+	return storage, nil
+}
+
+// pollForTokenWithProgress polls for token while reporting progress via Displayer.
+// Implements exponential backoff for slow_down errors per RFC 8628.
+func (c *Client) pollForTokenWithProgress(
+	ctx context.Context,
+	config *oauth2.Config,
+	deviceAuth *oauth2.DeviceAuthResponse,
+	d Displayer,
+) (*oauth2.Token, error) {
+	// Initial polling interval (from DeviceAuthResponse)
+	interval := deviceAuth.Interval
+	if interval == 0 {
+		interval = 5 // Default to 5 seconds per RFC 8628
+	}
+
+	// Exponential backoff state
+	pollInterval := time.Duration(interval) * time.Second
+	backoffMultiplier := 1.0
+
+	pollTicker := time.NewTicker(pollInterval)
+	defer pollTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+
+		case <-pollTicker.C:
+			// Attempt to exchange device code for token
+			token, err := c.exchangeDeviceCode(
+				ctx,
+				config.Endpoint.TokenURL,
+				config.ClientID,
+				deviceAuth.DeviceCode,
+			)
+			if err != nil {
+				var oauthErr *oauth2.RetrieveError
+				if errors.As(err, &oauthErr) {
+					// Parse OAuth error response
+					var errResp ErrorResponse
+					if jsonErr := json.Unmarshal(oauthErr.Body, &errResp); jsonErr == nil {
+						switch errResp.Error {
+						case "authorization_pending":
+							// User hasn't authorized yet, continue polling
+							continue
+
+						case "slow_down":
+							// Server requests slower polling - increase interval
+							backoffMultiplier *= 1.5
+							pollInterval = min(
+								time.Duration(float64(pollInterval)*backoffMultiplier),
+								60*time.Second,
+							)
+							pollTicker.Reset(pollInterval)
+							d.PollSlowDown(pollInterval)
+							continue
+
+						case "expired_token":
+							return nil, errors.New("device code expired, please restart the flow")
+
+						case "access_denied":
+							return nil, errors.New("user denied authorization")
+
+						default:
+							return nil, fmt.Errorf(
+								"authorization failed: %s - %s",
+								errResp.Error,
+								errResp.ErrorDescription,
+							)
+						}
+					}
+				}
+				// Unknown error
+				return nil, fmt.Errorf("token exchange failed: %w", err)
+			}
+
+			// Success!
+			return token, nil
+		}
+	}
+}
+
+// exchangeDeviceCode exchanges device code for access token
+func (c *Client) exchangeDeviceCode(
+	ctx context.Context,
+	tokenURL, clientID, deviceCode string,
+) (*oauth2.Token, error) {
+	// Create request with timeout
+	reqCtx, cancel := context.WithTimeout(ctx, tokenExchangeTimeout)
+	defer cancel()
+
+	data := url.Values{}
+	data.Set("grant_type", "urn:ietf:params:oauth:grant-type:device_code")
+	data.Set("device_code", deviceCode)
+	data.Set("client_id", clientID)
+
+	req, err := http.NewRequestWithContext(
+		reqCtx,
+		http.MethodPost,
+		tokenURL,
+		strings.NewReader(data.Encode()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.do(reqCtx, req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	skew := serverClockSkew(resp.Header, time.Now())
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// Handle non-200 responses
+	if resp.StatusCode != http.StatusOK {
+		return nil, &oauth2.RetrieveError{
+			Response: resp,
+			Body:     body,
+		}
+	}
+
+	// Parse successful token response
+	var tokenResp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		Scope        string `json:"scope"`
+		IDToken      string `json:"id_token"`
+	}
+
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+
+	// Validate token response
+	if err := validateTokenResponse(
+		tokenResp.AccessToken,
+		tokenResp.TokenType,
+		tokenResp.ExpiresIn,
+	); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+
+	token := &oauth2.Token{
+		AccessToken:  tokenResp.AccessToken,
+		RefreshToken: tokenResp.RefreshToken,
+		TokenType:    tokenResp.TokenType,
+		Expiry:       time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
+	}
+
+	return token.WithExtra(map[string]any{
+		"scope":      tokenResp.Scope,
+		"id_token":   tokenResp.IDToken,
+		"clock_skew": skew,
+	}), nil
+}
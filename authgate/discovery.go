@@ -0,0 +1,315 @@
+package authgate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default endpoint paths, used when discovery is disabled or the server does
+// not publish metadata.
+const (
+	defaultDeviceAuthorizationPath = "/oauth/device/code"
+	defaultTokenPath               = "/oauth/token"
+	defaultIntrospectionPath       = "/oauth/introspect"
+	defaultRevocationPath          = "/oauth/revoke"
+)
+
+// Discovery configuration
+const (
+	discoveryTimeout         = 10 * time.Second
+	defaultMetadataCacheTTL  = 1 * time.Hour
+	failedDiscoveryTTL       = 1 * time.Minute
+	maxMetadataResponseBytes = 1 << 20
+)
+
+// Metadata holds the authorization server endpoints advertised through
+// OpenID Connect Discovery or RFC 8414 server metadata.
+type Metadata struct {
+	Issuer                      string `json:"issuer,omitempty"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint,omitempty"`
+	TokenEndpoint               string `json:"token_endpoint,omitempty"`
+	IntrospectionEndpoint       string `json:"introspection_endpoint,omitempty"`
+	RevocationEndpoint          string `json:"revocation_endpoint,omitempty"`
+	JWKSURI                     string `json:"jwks_uri,omitempty"`
+}
+
+// metadataCache is the on-disk format of a cached discovery document.
+type metadataCache struct {
+	ServerURL string    `json:"server_url"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Metadata  *Metadata `json:"metadata"`
+}
+
+// discovered memoizes discovered metadata per server URL for as long as the
+// metadata cache file would keep it. A failed discovery is memoized with nil
+// Metadata for failedDiscoveryTTL, so that the requests of one command do not
+// each wait for an unreachable server.
+var discovered sync.Map // server URL -> *metadataCache
+
+// DefaultMetadataCachePath returns the file used to cache serverURL's
+// metadata under the user's cache directory, or "" if there is none.
+func DefaultMetadataCachePath(serverURL string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(serverURL))
+	return filepath.Join(dir, "authgate", "metadata-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// endpoints returns the metadata used to build request URLs. Explicit
+// c.Metadata wins; otherwise discovery runs if enabled, and any endpoint the
+// server does not advertise falls back to the default AuthGate path.
+func (c *Client) endpoints(ctx context.Context) *Metadata {
+	m := c.Metadata
+	if m == nil && c.Discovery {
+		// Discovery failures are not fatal: the default paths still work
+		// against a stock AuthGate server.
+		m = c.discoveredMetadata(ctx)
+	}
+	if m == nil {
+		m = &Metadata{}
+	}
+
+	base := strings.TrimRight(c.ServerURL, "/")
+	return &Metadata{
+		Issuer: m.Issuer,
+		DeviceAuthorizationEndpoint: firstNonEmpty(
+			m.DeviceAuthorizationEndpoint, base+defaultDeviceAuthorizationPath,
+		),
+		TokenEndpoint: firstNonEmpty(m.TokenEndpoint, base+defaultTokenPath),
+		IntrospectionEndpoint: firstNonEmpty(
+			m.IntrospectionEndpoint, base+defaultIntrospectionPath,
+		),
+		RevocationEndpoint: firstNonEmpty(m.RevocationEndpoint, base+defaultRevocationPath),
+		JWKSURI:            firstNonEmpty(m.JWKSURI, base+defaultJWKSPath),
+	}
+}
+
+// discoveredMetadata returns the server's metadata from memory while it is
+// fresh, or runs discovery. It returns nil when discovery fails.
+func (c *Client) discoveredMetadata(ctx context.Context) *Metadata {
+	if v, ok := discovered.Load(c.ServerURL); ok {
+		if cache := v.(*metadataCache); time.Now().Before(cache.ExpiresAt) {
+			return cache.Metadata
+		}
+	}
+	cache, err := c.discover(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			discovered.Store(c.ServerURL, &metadataCache{
+				ServerURL: c.ServerURL,
+				ExpiresAt: time.Now().Add(failedDiscoveryTTL),
+			})
+		}
+		return nil
+	}
+	discovered.Store(c.ServerURL, cache)
+	return cache.Metadata
+}
+
+// Discover fetches the server's metadata, trying the OpenID Connect location
+// first and the RFC 8414 location second. A fresh copy in c.MetadataCacheFile
+// is used instead of the network when available, and fetched metadata is
+// written back to it.
+func (c *Client) Discover(ctx context.Context) (*Metadata, error) {
+	cache, err := c.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cache.Metadata, nil
+}
+
+// discover is Discover, also returning when the metadata expires.
+func (c *Client) discover(ctx context.Context) (*metadataCache, error) {
+	if cache := c.readMetadataCache(); cache != nil {
+		return cache, nil
+	}
+
+	var errs []error
+	for _, wellKnown := range wellKnownURLs(c.ServerURL) {
+		m, ttl, err := c.fetchMetadata(ctx, wellKnown)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		c.writeMetadataCache(m, ttl)
+		return &metadataCache{
+			ServerURL: c.ServerURL,
+			ExpiresAt: time.Now().Add(ttl),
+			Metadata:  m,
+		}, nil
+	}
+	return nil, fmt.Errorf("metadata discovery failed: %w", errors.Join(errs...))
+}
+
+// wellKnownURLs returns the OpenID Connect and RFC 8414 metadata URLs for
+// serverURL. RFC 8414 inserts the well-known segment before any path.
+func wellKnownURLs(serverURL string) []string {
+	base := strings.TrimRight(serverURL, "/")
+	urls := []string{base + "/.well-known/openid-configuration"}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return urls
+	}
+	path := u.Path
+	u.Path = "/.well-known/oauth-authorization-server" + path
+	u.RawPath = ""
+	return append(urls, u.String())
+}
+
+// fetchMetadata retrieves and validates one metadata document, returning
+// how long it may be cached.
+func (c *Client) fetchMetadata(
+	ctx context.Context,
+	metadataURL string,
+) (*Metadata, time.Duration, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.do(reqCtx, req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", metadataURL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMetadataResponseBytes))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: failed to read response: %w", metadataURL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("%s: status %d", metadataURL, resp.StatusCode)
+	}
+
+	var m Metadata
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, 0, fmt.Errorf("%s: failed to parse metadata: %w", metadataURL, err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", metadataURL, err)
+	}
+	// The issuer must be the server the metadata was requested for (RFC 8414
+	// section 3.3), or another server could claim its tokens.
+	if normalizeServerURL(m.Issuer) != normalizeServerURL(c.ServerURL) {
+		return nil, 0, fmt.Errorf(
+			"%s: issuer %q does not match %s", metadataURL, m.Issuer, c.ServerURL,
+		)
+	}
+
+	return &m, metadataTTL(resp.Header.Get("Cache-Control")), nil
+}
+
+// validate checks that the document advertises a token endpoint and that every
+// advertised endpoint is an absolute http(s) URL.
+func (m *Metadata) validate() error {
+	if m.TokenEndpoint == "" {
+		return errors.New("metadata has no token_endpoint")
+	}
+	for name, endpoint := range map[string]string{
+		"device_authorization_endpoint": m.DeviceAuthorizationEndpoint,
+		"token_endpoint":                m.TokenEndpoint,
+		"introspection_endpoint":        m.IntrospectionEndpoint,
+		"revocation_endpoint":           m.RevocationEndpoint,
+		"jwks_uri":                      m.JWKSURI,
+	} {
+		if endpoint == "" {
+			continue
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid %s: %q", name, endpoint)
+		}
+	}
+	return nil
+}
+
+// metadataTTL returns the max-age from a Cache-Control header, or the default.
+func metadataTTL(cacheControl string) time.Duration {
+	for directive := range strings.SplitSeq(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if !strings.EqualFold(name, "max-age") {
+			continue
+		}
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return defaultMetadataCacheTTL
+}
+
+// readMetadataCache returns the cached metadata for c.ServerURL if it has not
+// expired.
+func (c *Client) readMetadataCache() *metadataCache {
+	if c.MetadataCacheFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.MetadataCacheFile)
+	if err != nil {
+		return nil
+	}
+	var cache metadataCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil
+	}
+	if cache.ServerURL != c.ServerURL || cache.Metadata == nil ||
+		time.Now().After(cache.ExpiresAt) {
+		return nil
+	}
+	return &cache
+}
+
+// writeMetadataCache stores m in c.MetadataCacheFile. Failures only cost a
+// refetch next time, so they are ignored.
+func (c *Client) writeMetadataCache(m *Metadata, ttl time.Duration) {
+	if c.MetadataCacheFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(metadataCache{
+		ServerURL: c.ServerURL,
+		ExpiresAt: time.Now().Add(ttl),
+		Metadata:  m,
+	}, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.MetadataCacheFile), 0o700); err != nil {
+		return
+	}
+	tempFile := c.MetadataCacheFile + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0o600); err != nil {
+		return
+	}
+	if err := os.Rename(tempFile, c.MetadataCacheFile); err != nil {
+		_ = os.Remove(tempFile)
+	}
+}
+
+// firstNonEmpty returns the first non-empty string.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,251 @@
+package authgate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWellKnownURLs(t *testing.T) {
+	tests := []struct {
+		serverURL string
+		want      []string
+	}{
+		{
+			serverURL: "https://auth.example.com",
+			want: []string{
+				"https://auth.example.com/.well-known/openid-configuration",
+				"https://auth.example.com/.well-known/oauth-authorization-server",
+			},
+		},
+		{
+			serverURL: "https://gw.example.com/authgate/",
+			want: []string{
+				"https://gw.example.com/authgate/.well-known/openid-configuration",
+				"https://gw.example.com/.well-known/oauth-authorization-server/authgate",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := wellKnownURLs(tt.serverURL); !slices.Equal(got, tt.want) {
+			t.Errorf("wellKnownURLs(%q) = %v, want %v", tt.serverURL, got, tt.want)
+		}
+	}
+}
+
+func TestMetadataTTL(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", defaultMetadataCacheTTL},
+		{"public, max-age=600", 10 * time.Minute},
+		{"Max-Age=60", time.Minute},
+		{"max-age=0", defaultMetadataCacheTTL},
+		{"no-cache", defaultMetadataCacheTTL},
+	}
+
+	for _, tt := range tests {
+		if got := metadataTTL(tt.header); got != tt.want {
+			t.Errorf("metadataTTL(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+// newGatewayServer serves RFC 8414 metadata only, advertising a token
+// endpoint at a rewritten path as a gateway in front of AuthGate would.
+func newGatewayServer(t *testing.T, metadataHits, refreshHits *atomic.Int32) *httptest.Server {
+	t.Helper()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/oauth-authorization-server":
+			metadataHits.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"issuer":         server.URL,
+				"token_endpoint": server.URL + "/gateway/token",
+			})
+		case "/gateway/token":
+			refreshHits.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"access_token":  "discovered-access-token",
+				"refresh_token": "discovered-refresh-token",
+				"token_type":    "Bearer",
+				"expires_in":    3600,
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDiscovery_UsesAdvertisedTokenEndpoint(t *testing.T) {
+	var metadataHits, refreshHits atomic.Int32
+	server := newGatewayServer(t, &metadataHits, &refreshHits)
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	c.Discovery = true
+
+	storage, err := c.RefreshAccessToken(context.Background(), "old-refresh-token", noopDisplayer{})
+	if err != nil {
+		t.Fatalf("RefreshAccessToken() error = %v", err)
+	}
+	if storage.AccessToken != "discovered-access-token" {
+		t.Errorf("AccessToken = %s, want discovered-access-token", storage.AccessToken)
+	}
+	if refreshHits.Load() != 1 {
+		t.Errorf("refresh hits at advertised endpoint = %d, want 1", refreshHits.Load())
+	}
+
+	// Endpoints the server does not advertise fall back to the default paths.
+	endpoints := c.endpoints(context.Background())
+	want := server.URL + defaultDeviceAuthorizationPath
+	if got := endpoints.DeviceAuthorizationEndpoint; got != want {
+		t.Errorf("DeviceAuthorizationEndpoint = %s, want %s", got, want)
+	}
+	if metadataHits.Load() != 1 {
+		t.Errorf("metadata fetched %d times, want 1 (memoized per process)", metadataHits.Load())
+	}
+}
+
+func TestDiscover_CachesOnDisk(t *testing.T) {
+	var metadataHits, refreshHits atomic.Int32
+	server := newGatewayServer(t, &metadataHits, &refreshHits)
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	c.MetadataCacheFile = filepath.Join(t.TempDir(), "metadata.json")
+
+	for range 2 {
+		m, err := c.Discover(context.Background())
+		if err != nil {
+			t.Fatalf("Discover() error = %v", err)
+		}
+		if m.TokenEndpoint != server.URL+"/gateway/token" {
+			t.Errorf("TokenEndpoint = %s, want advertised endpoint", m.TokenEndpoint)
+		}
+	}
+	if got := metadataHits.Load(); got != 1 {
+		t.Errorf("metadata fetched %d times, want 1 (second read from cache)", got)
+	}
+
+	// An expired cache entry is ignored and refreshed from the server.
+	c.writeMetadataCache(&Metadata{TokenEndpoint: "https://stale.example.com/token"}, -time.Minute)
+	m, err := c.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover() after expiry error = %v", err)
+	}
+	if m.TokenEndpoint != server.URL+"/gateway/token" {
+		t.Errorf("TokenEndpoint = %s, want refetched endpoint", m.TokenEndpoint)
+	}
+	if got := metadataHits.Load(); got != 2 {
+		t.Errorf("metadata fetched %d times, want 2 after expiry", got)
+	}
+}
+
+func TestDiscovery_FallsBackToDefaults(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	c.Discovery = true
+
+	if _, err := c.Discover(context.Background()); err == nil {
+		t.Error("Discover() expected error when server publishes no metadata")
+	}
+
+	endpoints := c.endpoints(context.Background())
+	if want := server.URL + defaultTokenPath; endpoints.TokenEndpoint != want {
+		t.Errorf("TokenEndpoint = %s, want %s", endpoints.TokenEndpoint, want)
+	}
+}
+
+func TestDiscovery_MemoExpires(t *testing.T) {
+	var up atomic.Bool
+	var metadataHits, failedHits atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			failedHits.Add(1)
+			http.NotFound(w, r)
+			return
+		}
+		metadataHits.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":         server.URL,
+			"token_endpoint": server.URL + "/gateway/token",
+		})
+	}))
+	defer server.Close()
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	c.Discovery = true
+	ctx := context.Background()
+	expire := func() {
+		v, _ := discovered.Load(server.URL)
+		v.(*metadataCache).ExpiresAt = time.Now().Add(-time.Minute)
+	}
+
+	for range 2 {
+		if got := c.endpoints(ctx).TokenEndpoint; got != server.URL+defaultTokenPath {
+			t.Errorf("TokenEndpoint while discovery fails = %s, want default", got)
+		}
+	}
+	if got := failedHits.Load(); got != 2 {
+		t.Errorf("failed discovery requested %d documents, want 2 (memoized)", got)
+	}
+
+	up.Store(true)
+	expire()
+	if got := c.endpoints(ctx).TokenEndpoint; got != server.URL+"/gateway/token" {
+		t.Errorf("TokenEndpoint after recovery = %s, want advertised endpoint", got)
+	}
+	expire()
+	c.endpoints(ctx)
+	if got := metadataHits.Load(); got != 2 {
+		t.Errorf("metadata fetched %d times, want 2 (refetched after expiry)", got)
+	}
+}
+
+func TestDiscover_RejectsForeignIssuer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":         "https://evil.example.com",
+			"token_endpoint": "https://evil.example.com/token",
+		})
+	}))
+	defer server.Close()
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	if _, err := c.Discover(context.Background()); err == nil ||
+		!strings.Contains(err.Error(), "does not match") {
+		t.Errorf("Discover() error = %v, want issuer mismatch", err)
+	}
+}
+
+func TestMetadataValidate(t *testing.T) {
+	if err := (&Metadata{}).validate(); err == nil {
+		t.Error("validate() expected error without token_endpoint")
+	}
+	m := &Metadata{TokenEndpoint: "https://auth.example.com/token", RevocationEndpoint: "/revoke"}
+	if err := m.validate(); err == nil {
+		t.Error("validate() expected error for relative endpoint")
+	}
+}
@@ -0,0 +1,135 @@
+package authgate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLockTimeout is how long token stores wait for the token file lock
+// when no timeout is configured.
+const DefaultLockTimeout = 5 * time.Second
+
+// lockRetryDelay is the interval between attempts to take a busy lock.
+const lockRetryDelay = 50 * time.Millisecond
+
+// ErrLockTimeout is returned when the token file lock is not acquired within
+// the lock timeout.
+var ErrLockTimeout = errors.New("timeout waiting for file lock")
+
+// errLockBusy is returned by tryLock when another holder has the lock.
+var errLockBusy = errors.New("lock is held by another process")
+
+// fileLock represents a kernel advisory lock on the token file's lock file.
+// The kernel drops the lock when the holder exits, so a crashed process
+// never leaves the file locked.
+type fileLock struct {
+	lockFile *os.File
+	lockPath string
+}
+
+// acquireFileLock takes an exclusive lock on filePath+".lock", waiting up to
+// timeout (DefaultLockTimeout when zero) or until ctx is done. The holder's
+// PID is written to the lock file for diagnostics.
+func acquireFileLock(
+	ctx context.Context,
+	filePath string,
+	timeout time.Duration,
+) (*fileLock, error) {
+	lock, err := lockFile(ctx, filePath, true, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if err := lock.lockFile.Truncate(0); err == nil {
+		_, _ = lock.lockFile.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	}
+	return lock, nil
+}
+
+// acquireSharedLock takes a shared lock on filePath+".lock", which excludes
+// writers but not other readers, waiting up to timeout or until ctx is done.
+func acquireSharedLock(
+	ctx context.Context,
+	filePath string,
+	timeout time.Duration,
+) (*fileLock, error) {
+	return lockFile(ctx, filePath, false, timeout)
+}
+
+// lockFile opens the lock file and retries tryLock until it succeeds, timeout
+// expires or ctx is done.
+func lockFile(
+	ctx context.Context,
+	filePath string,
+	exclusive bool,
+	timeout time.Duration,
+) (*fileLock, error) {
+	if timeout <= 0 {
+		timeout = DefaultLockTimeout
+	}
+	lockPath := filePath + ".lock"
+
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := tryLock(f, exclusive)
+		if err == nil {
+			return &fileLock{lockFile: f, lockPath: lockPath}, nil
+		}
+		if !errors.Is(err, errLockBusy) {
+			f.Close()
+			return nil, fmt.Errorf("failed to acquire file lock: %w", err)
+		}
+		if time.Now().After(deadline) {
+			holder := lockHolder(lockPath)
+			f.Close()
+			return nil, fmt.Errorf("%w after %v%s", ErrLockTimeout, timeout, holder)
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockRetryDelay):
+		}
+	}
+}
+
+// lockHolder describes the PID recorded in the lock file, if any.
+func lockHolder(lockPath string) string {
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		return ""
+	}
+	if pid := strings.TrimSpace(string(data)); pid != "" {
+		return " (held by pid " + pid + ")"
+	}
+	return ""
+}
+
+// release releases the file lock. The lock file itself is kept: removing it
+// would let a waiter lock an unlinked file while a newcomer locks a new one.
+func (fl *fileLock) release() error {
+	if fl.lockFile == nil {
+		return nil
+	}
+	err := unlock(fl.lockFile)
+	if closeErr := fl.lockFile.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// isLockUnavailable reports whether err means the lock file cannot be
+// created, as in a read-only directory, so that readers may go without.
+func isLockUnavailable(err error) bool {
+	return errors.Is(err, fs.ErrPermission) || errors.Is(err, errors.ErrUnsupported)
+}
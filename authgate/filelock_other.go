@@ -0,0 +1,41 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package authgate
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// staleLockTimeout is the age after which a lock marker is taken to be left
+// behind by a process that crashed while holding the lock.
+const staleLockTimeout = 30 * time.Second
+
+// tryLock creates the marker file <lock file>.excl exclusively, as kernel
+// advisory locks are not used on this platform. Shared locks are taken as
+// exclusive ones. A stale marker is removed first.
+func tryLock(f *os.File, exclusive bool) error {
+	marker := f.Name() + ".excl"
+	m, err := os.OpenFile(marker, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err == nil {
+		return m.Close()
+	}
+	if !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	info, err := os.Stat(marker)
+	if err != nil || time.Since(info.ModTime()) <= staleLockTimeout {
+		return errLockBusy
+	}
+	if err := os.Remove(marker); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return tryLock(f, exclusive)
+}
+
+// unlock removes the marker file created by tryLock.
+func unlock(f *os.File) error {
+	return os.Remove(f.Name() + ".excl")
+}
@@ -0,0 +1,164 @@
+package authgate
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAcquireAndRelease(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "tokens.json")
+
+	lock, err := acquireFileLock(context.Background(), target, 0)
+	if err != nil {
+		t.Fatalf("acquireFileLock() error: %v", err)
+	}
+
+	lockPath := target + ".lock"
+	data, err := os.ReadFile(lockPath)
+	if err != nil {
+		t.Fatalf("lock file was not created: %v", err)
+	}
+	if want := strconv.Itoa(os.Getpid()); string(data) != want {
+		t.Errorf("lock file holds %q, want pid %s", data, want)
+	}
+
+	if err := lock.release(); err != nil {
+		t.Errorf("release() error: %v", err)
+	}
+
+	// The lock can be taken again once released.
+	lock, err = acquireFileLock(context.Background(), target, 0)
+	if err != nil {
+		t.Fatalf("acquireFileLock() after release error: %v", err)
+	}
+	_ = lock.release()
+}
+
+func TestConcurrentLocks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "tokens.json")
+
+	const goroutines = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	concurrent := 0
+
+	for i := range goroutines {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+
+			lock, err := acquireFileLock(context.Background(), target, 0)
+			if err != nil {
+				t.Errorf("goroutine %d: acquireFileLock() error: %v", idx, err)
+				return
+			}
+
+			mu.Lock()
+			concurrent++
+			if concurrent > 1 {
+				t.Errorf("goroutine %d: more than one lock holder at a time: %d", idx, concurrent)
+			}
+			mu.Unlock()
+
+			mu.Lock()
+			concurrent--
+			mu.Unlock()
+
+			_ = lock.release()
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+func TestLockTimeout(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "tokens.json")
+
+	lock, err := acquireFileLock(context.Background(), target, 0)
+	if err != nil {
+		t.Fatalf("acquireFileLock() error: %v", err)
+	}
+	defer lock.release()
+
+	start := time.Now()
+	_, err = acquireFileLock(context.Background(), target, 200*time.Millisecond)
+	if err == nil {
+		t.Fatal("acquireFileLock() succeeded while the lock was held")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("acquireFileLock() waited %v, want about 200ms", elapsed)
+	}
+	if want := "pid " + strconv.Itoa(os.Getpid()); !strings.Contains(err.Error(), want) {
+		t.Errorf("timeout error %q does not name the holder (%s)", err, want)
+	}
+	if _, err := acquireSharedLock(context.Background(), target, 100*time.Millisecond); err == nil {
+		t.Error("acquireSharedLock() succeeded while an exclusive lock was held")
+	}
+}
+
+func TestSharedLocks(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "tokens.json")
+
+	first, err := acquireSharedLock(context.Background(), target, 0)
+	if err != nil {
+		t.Fatalf("acquireSharedLock() error: %v", err)
+	}
+	defer first.release()
+
+	second, err := acquireSharedLock(context.Background(), target, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("second acquireSharedLock() error: %v", err)
+	}
+	defer second.release()
+
+	if _, err := acquireFileLock(context.Background(), target, 100*time.Millisecond); err == nil {
+		t.Error("acquireFileLock() succeeded while shared locks were held")
+	}
+}
+
+func TestLockReleasedWhenHolderExits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell to hold the lock")
+	}
+	flock, err := exec.LookPath("flock")
+	if err != nil {
+		t.Skip("flock(1) not available")
+	}
+	target := filepath.Join(t.TempDir(), "tokens.json")
+
+	// flock -o holds the lock in the flock process only, so killing it
+	// simulates a holder that crashes.
+	cmd := exec.Command(flock, "-o", target+".lock", "sleep", "5")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start flock: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		probe, err := acquireFileLock(context.Background(), target, lockRetryDelay)
+		if err != nil {
+			break
+		}
+		_ = probe.release()
+		if time.Now().After(deadline) {
+			t.Fatal("flock(1) never took the lock")
+		}
+	}
+	_ = cmd.Process.Kill()
+	_ = cmd.Wait()
+
+	lock, err := acquireFileLock(context.Background(), target, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("acquireFileLock() after holder died: %v", err)
+	}
+	_ = lock.release()
+}
@@ -0,0 +1,35 @@
+//go:build windows
+
+package authgate
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockedRange covers the whole lock file.
+const lockedRange = ^uint32(0)
+
+// tryLock takes a LockFileEx lock on f without blocking.
+func tryLock(f *os.File, exclusive bool) error {
+	flags := uint32(windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if exclusive {
+		flags |= windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+	err := windows.LockFileEx(
+		windows.Handle(f.Fd()), flags, 0, lockedRange, lockedRange, new(windows.Overlapped),
+	)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return errLockBusy
+	}
+	return err
+}
+
+// unlock releases the LockFileEx lock on f.
+func unlock(f *os.File) error {
+	return windows.UnlockFileEx(
+		windows.Handle(f.Fd()), 0, lockedRange, lockedRange, new(windows.Overlapped),
+	)
+}
@@ -0,0 +1,127 @@
+package authgate
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ScopeOpenID is the scope that asks the server for an ID token.
+const ScopeOpenID = "openid"
+
+// idTokenLeeway is the clock difference tolerated when checking the exp and
+// iat claims of an ID token.
+const idTokenLeeway = time.Minute
+
+// ErrInvalidIDToken indicates that an ID token failed verification.
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// IDToken holds the claims of a verified OpenID Connect ID token.
+type IDToken struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        Audience `json:"aud"`
+	AuthorizedParty string   `json:"azp,omitempty"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce,omitempty"`
+
+	// Claims holds every claim of the token, including the ones above.
+	// Numbers are kept as json.Number.
+	Claims map[string]any `json:"-"`
+}
+
+// Expiry returns the time the ID token expires.
+func (t *IDToken) Expiry() time.Time {
+	return time.Unix(t.ExpiresAt, 0)
+}
+
+// VerifyIDToken verifies rawIDToken as an ID token issued to c.ClientID: its
+// signature against the issuer's JWKS, and its iss, aud, azp, exp and iat
+// claims. When nonce is not empty and the token carries a nonce, the two must
+// match. clockSkew is how far the server's clock is ahead of the local one,
+// as in TokenStorage.ClockSkew; exp and iat are checked against the server's
+// clock. Errors wrap ErrInvalidIDToken, unless the signing keys could not be
+// fetched.
+func (c *Client) VerifyIDToken(
+	ctx context.Context,
+	rawIDToken, nonce string,
+	clockSkew time.Duration,
+) (*IDToken, error) {
+	t, err := ParseJWT(rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	var token IDToken
+	if err := t.decodeClaims(&token); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidIDToken, err)
+	}
+	token.Claims = t.Claims
+
+	endpoints := c.endpoints(ctx)
+	if err := c.VerifyJWT(ctx, t); err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	now := time.Now().Add(clockSkew)
+	if err := token.validate(c.expectedIssuer(endpoints), c.ClientID, nonce, now); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	return &token, nil
+}
+
+// expectedIssuer returns the iss of tokens from c's server: the discovered
+// issuer, or the server URL.
+func (c *Client) expectedIssuer(endpoints *Metadata) string {
+	return firstNonEmpty(endpoints.Issuer, c.issuer())
+}
+
+// validate checks the claims of a token whose signature was verified, with
+// now on the server's clock.
+func (t *IDToken) validate(issuer, clientID, nonce string, now time.Time) error {
+	if normalizeServerURL(t.Issuer) != normalizeServerURL(issuer) {
+		return fmt.Errorf("issued by %q, want %q", t.Issuer, issuer)
+	}
+	if t.Subject == "" {
+		return errors.New("no sub claim")
+	}
+	if !t.Audience.Contains(clientID) {
+		return fmt.Errorf("audience %v does not include client %q", []string(t.Audience), clientID)
+	}
+	if t.AuthorizedParty != "" && t.AuthorizedParty != clientID {
+		return fmt.Errorf("authorized party %q is not client %q", t.AuthorizedParty, clientID)
+	}
+
+	if t.ExpiresAt == 0 {
+		return errors.New("no exp claim")
+	}
+	if now.After(t.Expiry().Add(idTokenLeeway)) {
+		return fmt.Errorf("expired at %s", t.Expiry().Format(time.RFC3339))
+	}
+	if t.IssuedAt == 0 {
+		return errors.New("no iat claim")
+	}
+	if issuedAt := time.Unix(t.IssuedAt, 0); issuedAt.After(now.Add(idTokenLeeway)) {
+		return fmt.Errorf("issued in the future at %s", issuedAt.Format(time.RFC3339))
+	}
+	if nonce != "" && t.Nonce != "" && t.Nonce != nonce {
+		return errors.New("nonce does not match the authorization request")
+	}
+	return nil
+}
+
+// newNonce returns a random value for the nonce parameter.
+func newNonce() string {
+	return rand.Text()
+}
+
+// requestsOpenID reports whether c asks for an ID token.
+func (c *Client) requestsOpenID() bool {
+	return slices.Contains(c.scopes(), ScopeOpenID)
+}
@@ -0,0 +1,381 @@
+package authgate
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testIssuer is an OpenID provider that publishes the public half of its
+// signing keys at the default JWKS path.
+type testIssuer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	keys        map[string]crypto.Signer // kid -> key
+	jwksFetches atomic.Int32
+	nonce       string // sent with the last device code request
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	iss := &testIssuer{keys: make(map[string]crypto.Signer)}
+	iss.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case defaultJWKSPath:
+			iss.jwksFetches.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{"keys": iss.publicKeys()})
+		case defaultDeviceAuthorizationPath:
+			iss.mu.Lock()
+			iss.nonce = r.FormValue("nonce")
+			iss.mu.Unlock()
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"device_code":      "device-code",
+				"user_code":        "USER-CODE",
+				"verification_uri": iss.URL + "/device",
+				"expires_in":       300,
+				"interval":         1,
+			})
+		case defaultTokenPath:
+			iss.mu.Lock()
+			claims := iss.claims(map[string]any{"nonce": iss.nonce})
+			iss.mu.Unlock()
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "openid-access-token",
+				"token_type":   "Bearer",
+				"expires_in":   3600,
+				"scope":        "openid profile",
+				"id_token":     iss.sign(t, "key-1", "RS256", claims),
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(iss.Close)
+	iss.addKey(t, "key-1", "RS256")
+	return iss
+}
+
+// addKey generates a signing key for alg and publishes it as kid.
+func (iss *testIssuer) addKey(t *testing.T, kid, alg string) {
+	t.Helper()
+	var key crypto.Signer
+	var err error
+	if strings.HasPrefix(alg, "ES") {
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	} else {
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.keys[kid] = key
+}
+
+// removeKey stops publishing kid.
+func (iss *testIssuer) removeKey(kid string) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	delete(iss.keys, kid)
+}
+
+func (iss *testIssuer) publicKeys() []map[string]string {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	b64 := base64.RawURLEncoding.EncodeToString
+	var keys []map[string]string
+	for kid, key := range iss.keys {
+		switch pub := key.Public().(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, map[string]string{
+				"kty": "RSA", "kid": kid, "use": "sig",
+				"n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			point, _ := pub.Bytes()
+			keys = append(keys, map[string]string{
+				"kty": "EC", "kid": kid, "crv": "P-256",
+				"x": b64(point[1:33]), "y": b64(point[33:]),
+			})
+		}
+	}
+	return keys
+}
+
+// claims returns valid ID token claims for test-client, with overrides
+// applied. A nil override removes the claim.
+func (iss *testIssuer) claims(overrides map[string]any) map[string]any {
+	now := time.Now()
+	claims := map[string]any{
+		"iss":   iss.URL,
+		"sub":   "user-1",
+		"aud":   "test-client",
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"email": "user@example.com",
+	}
+	for name, value := range overrides {
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+	}
+	return claims
+}
+
+// sign returns a JWT with claims signed by kid.
+func (iss *testIssuer) sign(t *testing.T, kid, alg string, claims map[string]any) string {
+	t.Helper()
+	iss.mu.Lock()
+	key := iss.keys[kid]
+	iss.mu.Unlock()
+
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	var err error
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key, digest[:])
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	iss := newTestIssuer(t)
+	iss.addKey(t, "ec-key", "ES256")
+	c := newTestClient(t)
+	c.ServerURL = iss.URL
+	ctx := context.Background()
+
+	token, err := c.VerifyIDToken(ctx, iss.sign(t, "key-1", "RS256", iss.claims(nil)), "", 0)
+	if err != nil {
+		t.Fatalf("VerifyIDToken(RS256) error = %v", err)
+	}
+	if token.Subject != "user-1" || token.Claims["email"] != "user@example.com" {
+		t.Errorf("VerifyIDToken() = %+v, want the signed claims", token)
+	}
+	_, err = c.VerifyIDToken(ctx, iss.sign(t, "ec-key", "ES256", iss.claims(nil)), "", 0)
+	if err != nil {
+		t.Errorf("VerifyIDToken(ES256) error = %v", err)
+	}
+
+	now := time.Now()
+	tests := []struct {
+		name   string
+		token  string
+		nonce  string
+		reason string
+	}{
+		{"wrong issuer", iss.sign(t, "key-1", "RS256",
+			iss.claims(map[string]any{"iss": "https://evil.example.com"})), "", "issued by"},
+		{"other audience", iss.sign(t, "key-1", "RS256",
+			iss.claims(map[string]any{"aud": []string{"other-client"}})), "", "audience"},
+		{"other authorized party", iss.sign(t, "key-1", "RS256",
+			iss.claims(map[string]any{"aud": []string{"test-client", "api"}, "azp": "api"})),
+			"", "authorized party"},
+		{"expired", iss.sign(t, "key-1", "RS256",
+			iss.claims(map[string]any{"exp": now.Add(-time.Hour).Unix()})), "", "expired"},
+		{"no exp", iss.sign(t, "key-1", "RS256",
+			iss.claims(map[string]any{"exp": nil})), "", "no exp"},
+		{"issued in the future", iss.sign(t, "key-1", "RS256",
+			iss.claims(map[string]any{"iat": now.Add(time.Hour).Unix()})), "", "future"},
+		{"nonce mismatch", iss.sign(t, "key-1", "RS256",
+			iss.claims(map[string]any{"nonce": "replayed"})), "expected", "nonce"},
+		{"unknown key", iss.signWithKid(t, "missing-key"), "", "no RS256 signing key"},
+		{"alg none", unsignedJWT(iss.claims(nil)), "", "unsupported alg"},
+		{"tampered claims", tamper(iss.sign(t, "key-1", "RS256", iss.claims(nil))), "",
+			"verification"},
+		{"not a JWT", "opaque-token", "", "not a JWT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.VerifyIDToken(ctx, tt.token, tt.nonce, 0)
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("VerifyIDToken() error = %v, want ErrInvalidIDToken", err)
+			}
+			if !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("VerifyIDToken() error = %v, want it to mention %q", err, tt.reason)
+			}
+		})
+	}
+
+	token, err = c.VerifyIDToken(ctx, iss.sign(t, "key-1", "RS256",
+		iss.claims(map[string]any{"nonce": "expected"})), "expected", 0)
+	if err != nil || token.Nonce != "expected" {
+		t.Errorf("VerifyIDToken() with matching nonce = %v, %v", token, err)
+	}
+
+	// exp and iat are on the server's clock, here half an hour ahead.
+	ahead := iss.sign(t, "key-1", "RS256", iss.claims(map[string]any{
+		"iat": now.Add(30 * time.Minute).Unix(),
+		"exp": now.Add(90 * time.Minute).Unix(),
+	}))
+	if _, err := c.VerifyIDToken(ctx, ahead, "", 30*time.Minute); err != nil {
+		t.Errorf("VerifyIDToken() with clock skew error = %v", err)
+	}
+	behind := iss.sign(t, "key-1", "RS256", iss.claims(map[string]any{
+		"iat": now.Add(-90 * time.Minute).Unix(),
+		"exp": now.Add(-30 * time.Minute).Unix(),
+	}))
+	if _, err := c.VerifyIDToken(ctx, behind, "", -time.Hour); err != nil {
+		t.Errorf("VerifyIDToken() with negative clock skew error = %v", err)
+	}
+}
+
+// signWithKid returns a token signed by key-1 that names kid in its header.
+func (iss *testIssuer) signWithKid(t *testing.T, kid string) string {
+	t.Helper()
+	iss.mu.Lock()
+	iss.keys[kid] = iss.keys["key-1"]
+	iss.mu.Unlock()
+	defer iss.removeKey(kid)
+	return iss.sign(t, kid, "RS256", iss.claims(nil))
+}
+
+// unsignedJWT returns an alg=none JWT with claims.
+func unsignedJWT(claims map[string]any) string {
+	payload, _ := json.Marshal(claims)
+	return base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload) + "."
+}
+
+// tamper replaces the claims of a signed JWT, keeping its signature.
+func tamper(token string) string {
+	parts := strings.Split(token, ".")
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	payload = []byte(strings.Replace(string(payload), "user-1", "admin", 1))
+	parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+	return strings.Join(parts, ".")
+}
+
+func TestVerifyIDToken_KeyRotation(t *testing.T) {
+	iss := newTestIssuer(t)
+	c := newTestClient(t)
+	c.ServerURL = iss.URL
+	c.JWKSCacheFile = filepath.Join(t.TempDir(), "jwks.json")
+	ctx := context.Background()
+
+	oldToken := iss.sign(t, "key-1", "RS256", iss.claims(nil))
+	for range 2 {
+		if _, err := c.VerifyIDToken(ctx, oldToken, "", 0); err != nil {
+			t.Fatalf("VerifyIDToken() error = %v", err)
+		}
+	}
+	if got := iss.jwksFetches.Load(); got != 1 {
+		t.Errorf("JWKS fetched %d times for one key, want 1", got)
+	}
+
+	// The server rotates to a new key; the cached set does not have it.
+	iss.addKey(t, "key-2", "RS256")
+	iss.removeKey("key-1")
+	newToken := iss.sign(t, "key-2", "RS256", iss.claims(nil))
+	if _, err := c.VerifyIDToken(ctx, newToken, "", 0); err != nil {
+		t.Fatalf("VerifyIDToken() after rotation error = %v", err)
+	}
+	if got := iss.jwksFetches.Load(); got != 2 {
+		t.Errorf("JWKS fetched %d times after rotation, want 2", got)
+	}
+
+	// A new process reads the rotated set from the cache file.
+	fetchedJWKS.Delete(iss.URL + defaultJWKSPath)
+	if _, err := c.VerifyIDToken(ctx, newToken, "", 0); err != nil {
+		t.Fatalf("VerifyIDToken() from cache file error = %v", err)
+	}
+	if got := iss.jwksFetches.Load(); got != 2 {
+		t.Errorf("JWKS fetched %d times with a cache file, want 2", got)
+	}
+}
+
+func TestPerformDeviceFlow_VerifiesIDToken(t *testing.T) {
+	iss := newTestIssuer(t)
+	c := newTestClient(t)
+	c.ServerURL = iss.URL
+	c.Scopes = []string{ScopeOpenID, "profile"}
+
+	storage, err := c.PerformDeviceFlow(context.Background(), noopDisplayer{})
+	if err != nil {
+		t.Fatalf("PerformDeviceFlow() error = %v", err)
+	}
+	if iss.nonce == "" {
+		t.Error("device code request carried no nonce")
+	}
+	if storage.IDToken == "" {
+		t.Fatal("PerformDeviceFlow() did not keep the ID token")
+	}
+	saved, err := c.LoadTokens()
+	if err != nil {
+		t.Fatalf("LoadTokens() error = %v", err)
+	}
+	if saved.IDToken != storage.IDToken {
+		t.Error("the ID token was not saved")
+	}
+	if got, _ := saved.Token().Extra("id_token").(string); got != storage.IDToken {
+		t.Error("Token() does not expose the ID token")
+	}
+}
+
+// idTokenRejections records the errors reported by IDTokenRejected.
+type idTokenRejections struct {
+	noopDisplayer
+	errs []error
+}
+
+func (d *idTokenRejections) IDTokenRejected(err error) { d.errs = append(d.errs, err) }
+
+func TestPerformDeviceFlow_RejectedIDToken(t *testing.T) {
+	iss := newTestIssuer(t)
+	c := newTestClient(t)
+	c.ServerURL = iss.URL
+	c.ClientID = "other-client" // not in the ID token's aud
+	c.Scopes = []string{ScopeOpenID, "profile"}
+
+	d := &idTokenRejections{}
+	storage, err := c.PerformDeviceFlow(context.Background(), d)
+	if err != nil {
+		t.Fatalf("PerformDeviceFlow() error = %v", err)
+	}
+	if len(d.errs) != 1 || !errors.Is(d.errs[0], ErrInvalidIDToken) {
+		t.Errorf("IDTokenRejected() reported %v, want one %v", d.errs, ErrInvalidIDToken)
+	}
+	saved, err := c.LoadTokens()
+	if err != nil {
+		t.Fatalf("LoadTokens() error = %v", err)
+	}
+	if storage.IDToken != "" || saved.IDToken != "" ||
+		saved.AccessToken != "openid-access-token" {
+		t.Errorf("saved access token %q and ID token %q, want the access token alone",
+			saved.AccessToken, saved.IDToken)
+	}
+}
@@ -0,0 +1,115 @@
+package authgate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Introspection is the response to an RFC 7662 token introspection request.
+// Only Active is guaranteed; servers omit the other members for inactive
+// tokens.
+type Introspection struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+}
+
+// Expiry returns the token's expiry time, or the zero time if the server did
+// not report one.
+func (i *Introspection) Expiry() time.Time {
+	if i.ExpiresAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(i.ExpiresAt, 0)
+}
+
+// Audience is the aud member of a token, which is either a single string or
+// an array of strings.
+type Audience []string
+
+// UnmarshalJSON accepts both forms of aud.
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("aud must be a string or an array of strings: %w", err)
+	}
+	*a = list
+	return nil
+}
+
+// Contains reports whether aud lists s.
+func (a Audience) Contains(s string) bool {
+	return slices.Contains(a, s)
+}
+
+// Introspect asks the server's introspection endpoint about token as
+// described in RFC 7662. hint is sent as token_type_hint and may be empty. A
+// token the server does not recognize is reported with Active false, not as
+// an error.
+func (c *Client) Introspect(ctx context.Context, token, hint string) (*Introspection, error) {
+	// Create request with timeout
+	reqCtx, cancel := context.WithTimeout(ctx, tokenVerificationTimeout)
+	defer cancel()
+
+	data := url.Values{}
+	data.Set("token", token)
+	if hint != "" {
+		data.Set("token_type_hint", hint)
+	}
+	data.Set("client_id", c.ClientID)
+
+	req, err := http.NewRequestWithContext(
+		reqCtx,
+		http.MethodPost,
+		c.endpoints(ctx).IntrospectionEndpoint,
+		strings.NewReader(data.Encode()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	// Execute request with retry logic
+	resp, err := c.do(reqCtx, req)
+	if err != nil {
+		return nil, fmt.Errorf("introspection request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ErrorResponse
+		if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != "" {
+			return nil, fmt.Errorf("%s: %s", errResp.Error, errResp.ErrorDescription)
+		}
+		return nil, fmt.Errorf(
+			"introspection failed with status %d: %s", resp.StatusCode, string(body),
+		)
+	}
+
+	var info Introspection
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse introspection response: %w", err)
+	}
+	return &info, nil
+}
@@ -0,0 +1,86 @@
+package authgate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestIntrospect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != defaultIntrospectionPath {
+			http.NotFound(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("client_id") != "test-client" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid_client"})
+			return
+		}
+		switch r.PostForm.Get("token") {
+		case "single-aud-token":
+			_, _ = w.Write([]byte(`{"active":true,"scope":"read write","client_id":"test-client",` +
+				`"sub":"user-1","aud":"https://api.example.com","exp":4102444800}`))
+		case "multi-aud-token":
+			_, _ = w.Write([]byte(`{"active":true,"aud":["api-a","api-b"]}`))
+		default:
+			_, _ = w.Write([]byte(`{"active":false}`))
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	ctx := context.Background()
+
+	info, err := c.Introspect(ctx, "single-aud-token", TokenTypeHintAccessToken)
+	if err != nil {
+		t.Fatalf("Introspect() error = %v", err)
+	}
+	want := Introspection{
+		Active:    true,
+		Scope:     "read write",
+		ClientID:  "test-client",
+		Subject:   "user-1",
+		Audience:  Audience{"https://api.example.com"},
+		ExpiresAt: 4102444800,
+	}
+	if info.Active != want.Active || info.Scope != want.Scope || info.ClientID != want.ClientID ||
+		info.Subject != want.Subject || !slices.Equal(info.Audience, want.Audience) ||
+		info.ExpiresAt != want.ExpiresAt {
+		t.Errorf("Introspect() = %+v, want %+v", info, want)
+	}
+	if got := info.Expiry(); !got.Equal(time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expiry() = %v, want 2100-01-01", got)
+	}
+
+	info, err = c.Introspect(ctx, "multi-aud-token", "")
+	if err != nil {
+		t.Fatalf("Introspect() error = %v", err)
+	}
+	if !slices.Equal(info.Audience, Audience{"api-a", "api-b"}) ||
+		!info.Audience.Contains("api-b") {
+		t.Errorf("Audience = %v, want [api-a api-b]", info.Audience)
+	}
+
+	info, err = c.Introspect(ctx, "revoked-token", TokenTypeHintAccessToken)
+	if err != nil {
+		t.Fatalf("Introspect() error = %v", err)
+	}
+	if info.Active || !info.Expiry().IsZero() {
+		t.Errorf("Introspect(revoked) = %+v, want inactive", info)
+	}
+
+	c.ClientID = "unknown-client"
+	if _, err := c.Introspect(ctx, "single-aud-token", ""); err == nil {
+		t.Error("Introspect() accepted an error response")
+	}
+}
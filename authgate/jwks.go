@@ -0,0 +1,278 @@
+package authgate
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWKS configuration
+const (
+	defaultJWKSPath      = "/.well-known/jwks.json"
+	jwksTimeout          = 10 * time.Second
+	maxJWKSResponseBytes = 1 << 20
+)
+
+// jsonWebKey is one public key of a JSON Web Key Set (RFC 7517).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// EC and OKP
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// jwksCache is a fetched key set, as kept in memory and on disk.
+type jwksCache struct {
+	URI       string       `json:"jwks_uri"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	Keys      []jsonWebKey `json:"keys"`
+}
+
+// fetchedJWKS memoizes key sets per JWKS URI for the life of the process.
+var fetchedJWKS sync.Map // JWKS URI -> *jwksCache
+
+// DefaultJWKSCachePath returns the file used to cache the signing keys of
+// serverURL under the user's cache directory, or "" if there is none.
+func DefaultJWKSCachePath(serverURL string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(serverURL))
+	return filepath.Join(dir, "authgate", "jwks-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// signingKey returns the public key for a token signed with alg by the key
+// kid. A cached key set is used while it is fresh; when it does not have the
+// key, the set is fetched again, so keys the server rotated in are found.
+func (c *Client) signingKey(ctx context.Context, uri, kid, alg string) (crypto.PublicKey, error) {
+	if set := c.cachedJWKS(uri); set != nil {
+		if key, ok := findKey(set.Keys, kid, alg); ok {
+			return key.publicKey()
+		}
+	}
+
+	set, err := c.fetchJWKS(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := findKey(set.Keys, kid, alg)
+	if !ok {
+		return nil, fmt.Errorf("no %s signing key with kid %q in %s", alg, kid, uri)
+	}
+	return key.publicKey()
+}
+
+// cachedJWKS returns the fresh key set for uri from memory or
+// c.JWKSCacheFile, or nil.
+func (c *Client) cachedJWKS(uri string) *jwksCache {
+	if v, ok := fetchedJWKS.Load(uri); ok {
+		if set := v.(*jwksCache); time.Now().Before(set.ExpiresAt) {
+			return set
+		}
+	}
+	if c.JWKSCacheFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.JWKSCacheFile)
+	if err != nil {
+		return nil
+	}
+	var set jwksCache
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil
+	}
+	if set.URI != uri || !time.Now().Before(set.ExpiresAt) {
+		return nil
+	}
+	fetchedJWKS.Store(uri, &set)
+	return &set
+}
+
+// fetchJWKS retrieves the key set at uri and caches it for the server's
+// Cache-Control max-age, or one hour by default.
+func (c *Client) fetchJWKS(ctx context.Context, uri string) (*jwksCache, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, jwksTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.do(reqCtx, req)
+	if err != nil {
+		return nil, fmt.Errorf("JWKS request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to read response: %w", uri, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: status %d", uri, resp.StatusCode)
+	}
+
+	set := &jwksCache{
+		URI:       uri,
+		ExpiresAt: time.Now().Add(metadataTTL(resp.Header.Get("Cache-Control"))),
+	}
+	if err := json.Unmarshal(body, set); err != nil {
+		return nil, fmt.Errorf("%s: failed to parse key set: %w", uri, err)
+	}
+	fetchedJWKS.Store(uri, set)
+	c.writeJWKSCache(set)
+	return set, nil
+}
+
+// writeJWKSCache stores set in c.JWKSCacheFile. Failures only cost a refetch
+// next time, so they are ignored.
+func (c *Client) writeJWKSCache(set *jwksCache) {
+	if c.JWKSCacheFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.JWKSCacheFile), 0o700); err != nil {
+		return
+	}
+	tempFile := c.JWKSCacheFile + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0o600); err != nil {
+		return
+	}
+	if err := os.Rename(tempFile, c.JWKSCacheFile); err != nil {
+		_ = os.Remove(tempFile)
+	}
+}
+
+// findKey returns the signature key in keys that can verify alg and has the
+// given kid. A token without kid matches the only suitable key, if there is
+// exactly one.
+func findKey(keys []jsonWebKey, kid, alg string) (*jsonWebKey, bool) {
+	var found *jsonWebKey
+	for i := range keys {
+		key := &keys[i]
+		if (key.Use != "" && key.Use != "sig") || (key.Alg != "" && key.Alg != alg) ||
+			key.Kty != keyTypeFor(alg) {
+			continue
+		}
+		if kid != "" {
+			if key.Kid == kid {
+				return key, true
+			}
+			continue
+		}
+		if found != nil {
+			return nil, false
+		}
+		found = key
+	}
+	return found, found != nil
+}
+
+// keyTypeFor returns the JWK key type that signs with alg.
+func keyTypeFor(alg string) string {
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		return "RSA"
+	case strings.HasPrefix(alg, "ES"):
+		return "EC"
+	case alg == "EdDSA":
+		return "OKP"
+	}
+	return ""
+}
+
+// publicKey decodes the key material of k.
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA key %q: %w", k.Kid, err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA key %q exponent", k.Kid)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %q", k.Crv)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil || len(x) != size || len(y) != size {
+			return nil, fmt.Errorf("invalid EC key %q coordinates", k.Kid)
+		}
+		point := append(append([]byte{4}, x...), y...)
+		key, err := ecdsa.ParseUncompressedPublicKey(curve, point)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC key %q: %w", k.Kid, err)
+		}
+		return key, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key %q", k.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// decodeBigInt decodes a base64url-encoded unsigned big-endian integer.
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,172 @@
+package authgate
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// ErrNotJWT indicates that a token is not a JWT in compact serialization,
+// such as an opaque access token.
+var ErrNotJWT = errors.New("not a JWT")
+
+// JWT is a decoded JSON Web Token. Decoding does not verify the signature;
+// see Client.VerifyJWT.
+type JWT struct {
+	// Header and Claims hold the decoded JOSE header and claims set. Numbers
+	// are kept as json.Number.
+	Header map[string]any
+	Claims map[string]any
+
+	header    jwtHeader
+	payload   []byte
+	signed    []byte // header.payload, as signed
+	signature []byte
+}
+
+// jwtHeader is the JOSE header of a signed JWT.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// ParseJWT decodes raw without verifying it. It returns an error wrapping
+// ErrNotJWT if raw is not a JWS compact serialization with JSON header and
+// claims.
+func ParseJWT(raw string) (*JWT, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrNotJWT
+	}
+
+	t := &JWT{signed: []byte(parts[0] + "." + parts[1])}
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrNotJWT, err)
+	}
+	if err := decodeJSON(header, &t.header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrNotJWT, err)
+	}
+	if err := decodeJSON(header, &t.Header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrNotJWT, err)
+	}
+	if t.payload, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrNotJWT, err)
+	}
+	if err := decodeJSON(t.payload, &t.Claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrNotJWT, err)
+	}
+	if t.signature, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrNotJWT, err)
+	}
+	return t, nil
+}
+
+// Expiry returns the time in the exp claim, and false if there is none.
+func (t *JWT) Expiry() (time.Time, bool) {
+	exp, ok := t.Claims["exp"].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := exp.Int64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
+
+// decodeClaims decodes the claims set into v.
+func (t *JWT) decodeClaims(v any) error {
+	return decodeJSON(t.payload, v)
+}
+
+// VerifyJWT checks the signature of t against the signing keys published by
+// c's server. Claims are not checked.
+func (c *Client) VerifyJWT(ctx context.Context, t *JWT) error {
+	hash, ok := jwtAlgHash[t.header.Alg]
+	if !ok {
+		return fmt.Errorf("unsupported alg %q", t.header.Alg)
+	}
+	key, err := c.signingKey(ctx, c.endpoints(ctx).JWKSURI, t.header.Kid, t.header.Alg)
+	if err != nil {
+		return err
+	}
+	return verifyJWTSignature(t.header.Alg, hash, key, t.signed, t.signature)
+}
+
+// jwtAlgHash maps the supported JWS algorithms to their hash.
+var jwtAlgHash = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"PS256": crypto.SHA256,
+	"PS384": crypto.SHA384,
+	"PS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+	"EdDSA": 0, // Ed25519 hashes the message itself
+}
+
+// verifyJWTSignature checks sig over signed with key for alg.
+func verifyJWTSignature(
+	alg string,
+	hash crypto.Hash,
+	key crypto.PublicKey,
+	signed, sig []byte,
+) error {
+	var digest []byte
+	if hash != 0 {
+		h := hash.New()
+		h.Write(signed)
+		digest = h.Sum(nil)
+	}
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "PS") {
+			opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+			return rsa.VerifyPSS(key, hash, digest, sig, opts)
+		}
+		return rsa.VerifyPKCS1v15(key, hash, digest, sig)
+
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size || key.Curve.Params().BitSize != ecdsaBits[alg] {
+			return errors.New("signature does not match the key")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, signed, sig) {
+			return errors.New("signature verification failed")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported key type %T", key)
+}
+
+// ecdsaBits is the curve size each ES algorithm signs with.
+var ecdsaBits = map[string]int{"ES256": 256, "ES384": 384, "ES512": 521}
+
+// decodeJSON decodes data into v, keeping numbers as json.Number.
+func decodeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
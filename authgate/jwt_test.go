@@ -0,0 +1,102 @@
+package authgate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseJWT(t *testing.T) {
+	iss := newTestIssuer(t)
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	token, err := ParseJWT(iss.sign(t, "key-1", "RS256", iss.claims(map[string]any{
+		"exp":   exp.Unix(),
+		"scope": "read write",
+	})))
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if token.Header["alg"] != "RS256" || token.Header["kid"] != "key-1" {
+		t.Errorf("Header = %v, want alg RS256 and kid key-1", token.Header)
+	}
+	wantExp := json.Number(strconv.FormatInt(exp.Unix(), 10))
+	if token.Claims["scope"] != "read write" || token.Claims["exp"] != wantExp {
+		t.Errorf("Claims = %v", token.Claims)
+	}
+	if got, ok := token.Expiry(); !ok || !got.Equal(exp) {
+		t.Errorf("Expiry() = %v, %v; want %v", got, ok, exp)
+	}
+
+	token, err = ParseJWT(unsignedJWT(iss.claims(map[string]any{"exp": nil})))
+	if err != nil {
+		t.Fatalf("ParseJWT(alg none) error = %v", err)
+	}
+	if _, ok := token.Expiry(); ok {
+		t.Error("Expiry() of a token without exp reported one")
+	}
+
+	for _, raw := range []string{"opaque-token", "a.b.c", "e30.bm90IGpzb24.", ""} {
+		if _, err := ParseJWT(raw); !errors.Is(err, ErrNotJWT) {
+			t.Errorf("ParseJWT(%q) error = %v, want ErrNotJWT", raw, err)
+		}
+	}
+}
+
+func TestVerifyJWT(t *testing.T) {
+	iss := newTestIssuer(t)
+	c := newTestClient(t)
+	c.ServerURL = iss.URL
+	ctx := context.Background()
+
+	token, err := ParseJWT(iss.sign(t, "key-1", "RS256", iss.claims(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifyJWT(ctx, token); err != nil {
+		t.Errorf("VerifyJWT() error = %v", err)
+	}
+
+	for name, raw := range map[string]string{
+		"tampered": tamper(iss.sign(t, "key-1", "RS256", iss.claims(nil))),
+		"alg none": unsignedJWT(iss.claims(nil)),
+	} {
+		token, err := ParseJWT(raw)
+		if err != nil {
+			t.Fatalf("ParseJWT(%s) error = %v", name, err)
+		}
+		if err := c.VerifyJWT(ctx, token); err == nil {
+			t.Errorf("VerifyJWT(%s) succeeded", name)
+		}
+	}
+}
+
+func TestTokenStorage_Expiry(t *testing.T) {
+	iss := newTestIssuer(t)
+	exp := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	local := time.Now().Add(time.Hour)
+
+	storage := &TokenStorage{
+		AccessToken: iss.sign(t, "key-1", "RS256", iss.claims(map[string]any{"exp": exp.Unix()})),
+		ExpiresAt:   local,
+	}
+	if got := storage.Expiry(); !got.Equal(exp) {
+		t.Errorf("Expiry() of a JWT = %v, want its exp %v", got, exp)
+	}
+
+	storage.AccessToken = "opaque-token"
+	if got := storage.Expiry(); !got.Equal(local) {
+		t.Errorf("Expiry() of an opaque token = %v, want ExpiresAt %v", got, local)
+	}
+	// Both are on the server's clock, which is five minutes ahead.
+	storage.ClockSkew = 5 * time.Minute
+	if got, want := storage.Expiry(), local.Add(-5*time.Minute); !got.Equal(want) {
+		t.Errorf("Expiry() with clock skew = %v, want %v", got, want)
+	}
+	if !storage.Valid(time.Minute) || storage.Valid(time.Hour) {
+		t.Errorf("Valid() disagrees with Expiry() %v", storage.Expiry())
+	}
+}
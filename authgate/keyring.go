@@ -0,0 +1,355 @@
+package authgate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Secret Service API names (https://specifications.freedesktop.org/secret-service/)
+const (
+	secretServiceName       = "org.freedesktop.secrets"
+	secretServicePath       = dbus.ObjectPath("/org/freedesktop/secrets")
+	secretDefaultCollection = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	secretServiceIface      = "org.freedesktop.Secret.Service"
+	secretCollectionIface   = "org.freedesktop.Secret.Collection"
+	secretItemIface         = "org.freedesktop.Secret.Item"
+	secretPromptIface       = "org.freedesktop.Secret.Prompt"
+	secretSessionIface      = "org.freedesktop.Secret.Session"
+	noPrompt                = dbus.ObjectPath("/")
+)
+
+// Keyring item attributes. Every saved entry is one item tagged with the
+// service attribute and its TokenKey.
+const (
+	keyringServiceAttr = "service"
+	keyringService     = "authgate"
+	keyringKeyAttr     = "token_key"
+	keyringPromptWait  = 2 * time.Minute
+)
+
+// secret is the Secret Service (oayays) secret structure.
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// SecretServiceStore keeps each token entry as an item in the default
+// collection of the Secret Service keyring (GNOME Keyring, KWallet) on the
+// D-Bus session bus, so tokens are never written to disk in plaintext.
+type SecretServiceStore struct {
+	// LockPath coordinates updates across processes through the lock file
+	// LockPath+".lock", the same lock a FileStore for LockPath would use.
+	// Updates are not coordinated when it is empty.
+	LockPath string
+	// LockTimeout bounds the wait for the lock. DefaultLockTimeout is used
+	// when zero.
+	LockTimeout time.Duration
+}
+
+// Load returns every AuthGate entry in the keyring.
+func (s *SecretServiceStore) Load() (map[string]*TokenStorage, error) {
+	kr, err := openKeyring()
+	if err != nil {
+		return nil, err
+	}
+	defer kr.close()
+
+	items, err := kr.items()
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("keyring: %w", fs.ErrNotExist)
+	}
+
+	tokens := make(map[string]*TokenStorage, len(items))
+	for key, item := range items {
+		tokens[key] = item.storage
+	}
+	return tokens, nil
+}
+
+// Update applies fn to the keyring entries while holding the lock file and
+// writes back the entries fn added, changed or removed.
+func (s *SecretServiceStore) Update(fn func(tokens map[string]*TokenStorage) (bool, error)) error {
+	return s.updateContext(context.Background(), fn)
+}
+
+func (s *SecretServiceStore) loadContext(context.Context) (map[string]*TokenStorage, error) {
+	return s.Load()
+}
+
+func (s *SecretServiceStore) updateContext(
+	ctx context.Context,
+	fn func(tokens map[string]*TokenStorage) (bool, error),
+) error {
+	if s.LockPath != "" {
+		lock, err := acquireFileLock(ctx, s.LockPath, s.LockTimeout)
+		if err != nil {
+			return fmt.Errorf("failed to acquire lock: %w", err)
+		}
+		defer func() {
+			if releaseErr := lock.release(); releaseErr != nil {
+				fmt.Fprintf(os.Stderr, "failed to release lock: %v\n", releaseErr)
+			}
+		}()
+	}
+
+	kr, err := openKeyring()
+	if err != nil {
+		return err
+	}
+	defer kr.close()
+
+	items, err := kr.items()
+	if err != nil {
+		return err
+	}
+	tokens := make(map[string]*TokenStorage, len(items))
+	for key, item := range items {
+		copied := *item.storage
+		tokens[key] = &copied
+	}
+
+	changed, err := fn(tokens)
+	if err != nil || !changed {
+		return err
+	}
+
+	for key, item := range items {
+		if _, ok := tokens[key]; !ok {
+			if err := kr.delete(item.path); err != nil {
+				return err
+			}
+		}
+	}
+	for key, storage := range tokens {
+		value, err := json.Marshal(storage)
+		if err != nil {
+			return err
+		}
+		if item, ok := items[key]; ok && bytes.Equal(item.value, value) {
+			continue
+		}
+		if err := kr.save(key, storage, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SecretServiceStore) String() string {
+	return "Secret Service keyring"
+}
+
+// keyring is an open connection and plain-text transfer session to the
+// Secret Service. Secrets travel unencrypted only over the local session bus.
+type keyring struct {
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+}
+
+// keyringItem is one saved entry as read from the keyring.
+type keyringItem struct {
+	path    dbus.ObjectPath
+	value   []byte
+	storage *TokenStorage
+}
+
+// openKeyring connects to the session bus and opens a Secret Service session.
+func openKeyring() (*keyring, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("keyring: failed to connect to session bus: %w", err)
+	}
+	var (
+		output  dbus.Variant
+		session dbus.ObjectPath
+	)
+	err = conn.Object(secretServiceName, secretServicePath).
+		Call(secretServiceIface+".OpenSession", 0, "plain", dbus.MakeVariant("")).
+		Store(&output, &session)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("keyring: failed to open session: %w", err)
+	}
+	return &keyring{conn: conn, session: session}, nil
+}
+
+// close ends the session and the bus connection.
+func (kr *keyring) close() {
+	kr.conn.Object(secretServiceName, kr.session).Call(secretSessionIface+".Close", 0)
+	kr.conn.Close()
+}
+
+// service returns the Secret Service object.
+func (kr *keyring) service() dbus.BusObject {
+	return kr.conn.Object(secretServiceName, secretServicePath)
+}
+
+// items returns the AuthGate entries in the keyring keyed by TokenKey,
+// unlocking them first if needed.
+func (kr *keyring) items() (map[string]keyringItem, error) {
+	var unlocked, locked []dbus.ObjectPath
+	err := kr.service().
+		Call(
+			secretServiceIface+".SearchItems", 0,
+			map[string]string{keyringServiceAttr: keyringService},
+		).
+		Store(&unlocked, &locked)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: search failed: %w", err)
+	}
+	if len(locked) > 0 {
+		paths, err := kr.unlock(locked)
+		if err != nil {
+			return nil, err
+		}
+		unlocked = append(unlocked, paths...)
+	}
+	if len(unlocked) == 0 {
+		return nil, nil
+	}
+
+	var secrets map[dbus.ObjectPath]secret
+	err = kr.service().
+		Call(secretServiceIface+".GetSecrets", 0, unlocked, kr.session).
+		Store(&secrets)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: failed to read secrets: %w", err)
+	}
+
+	items := make(map[string]keyringItem, len(secrets))
+	for path, sec := range secrets {
+		attrs, err := kr.conn.Object(secretServiceName, path).
+			GetProperty(secretItemIface + ".Attributes")
+		if err != nil {
+			return nil, fmt.Errorf("keyring: failed to read item attributes: %w", err)
+		}
+		attrMap, _ := attrs.Value().(map[string]string)
+		key := attrMap[keyringKeyAttr]
+		if key == "" {
+			continue
+		}
+		var storage TokenStorage
+		if err := json.Unmarshal(sec.Value, &storage); err != nil {
+			return nil, fmt.Errorf("keyring: failed to parse entry %s: %w", key, err)
+		}
+		items[key] = keyringItem{path: path, value: sec.Value, storage: &storage}
+	}
+	return items, nil
+}
+
+// save creates or replaces the item for key.
+func (kr *keyring) save(key string, storage *TokenStorage, value []byte) error {
+	if _, err := kr.unlock([]dbus.ObjectPath{secretDefaultCollection}); err != nil {
+		return err
+	}
+	props := map[string]dbus.Variant{
+		secretItemIface + ".Label": dbus.MakeVariant(
+			fmt.Sprintf("AuthGate tokens for %s at %s", storage.ClientID, storage.Issuer),
+		),
+		secretItemIface + ".Attributes": dbus.MakeVariant(map[string]string{
+			keyringServiceAttr: keyringService,
+			keyringKeyAttr:     key,
+		}),
+	}
+	sec := secret{Session: kr.session, Value: value, ContentType: "application/json"}
+
+	var item, prompt dbus.ObjectPath
+	err := kr.conn.Object(secretServiceName, secretDefaultCollection).
+		Call(secretCollectionIface+".CreateItem", 0, props, sec, true).
+		Store(&item, &prompt)
+	if err != nil {
+		return fmt.Errorf("keyring: failed to save entry %s: %w", key, err)
+	}
+	_, err = kr.prompt(prompt)
+	return err
+}
+
+// delete removes the item at path.
+func (kr *keyring) delete(path dbus.ObjectPath) error {
+	var prompt dbus.ObjectPath
+	err := kr.conn.Object(secretServiceName, path).
+		Call(secretItemIface+".Delete", 0).
+		Store(&prompt)
+	if err != nil {
+		return fmt.Errorf("keyring: failed to delete item: %w", err)
+	}
+	_, err = kr.prompt(prompt)
+	return err
+}
+
+// unlock unlocks objects, prompting the user if the keyring requires it, and
+// returns the paths that were unlocked.
+func (kr *keyring) unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, error) {
+	var (
+		unlocked []dbus.ObjectPath
+		prompt   dbus.ObjectPath
+	)
+	err := kr.service().Call(secretServiceIface+".Unlock", 0, objects).Store(&unlocked, &prompt)
+	if err != nil {
+		return nil, fmt.Errorf("keyring: unlock failed: %w", err)
+	}
+	result, err := kr.prompt(prompt)
+	if err != nil {
+		return nil, err
+	}
+	if paths, ok := result.Value().([]dbus.ObjectPath); ok {
+		unlocked = append(unlocked, paths...)
+	}
+	return unlocked, nil
+}
+
+// prompt shows the Secret Service prompt at path, if any, and waits for the
+// user to complete it.
+func (kr *keyring) prompt(path dbus.ObjectPath) (dbus.Variant, error) {
+	if path == noPrompt || path == "" {
+		return dbus.Variant{}, nil
+	}
+
+	if err := kr.conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(path),
+		dbus.WithMatchInterface(secretPromptIface),
+		dbus.WithMatchMember("Completed"),
+	); err != nil {
+		return dbus.Variant{}, fmt.Errorf("keyring: failed to watch prompt: %w", err)
+	}
+	signals := make(chan *dbus.Signal, 1)
+	kr.conn.Signal(signals)
+	defer kr.conn.RemoveSignal(signals)
+
+	call := kr.conn.Object(secretServiceName, path).Call(secretPromptIface+".Prompt", 0, "")
+	if err := call.Err; err != nil {
+		return dbus.Variant{}, fmt.Errorf("keyring: prompt failed: %w", err)
+	}
+
+	timeout := time.After(keyringPromptWait)
+	for {
+		select {
+		case sig := <-signals:
+			if sig.Path != path || len(sig.Body) != 2 {
+				continue
+			}
+			if dismissed, _ := sig.Body[0].(bool); dismissed {
+				return dbus.Variant{}, errors.New("keyring: prompt was dismissed")
+			}
+			result, _ := sig.Body[1].(dbus.Variant)
+			return result, nil
+		case <-timeout:
+			return dbus.Variant{}, fmt.Errorf(
+				"keyring: no answer to prompt after %v", keyringPromptWait,
+			)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package authgate
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// startSessionBus runs a private dbus-daemon for the test and points
+// DBUS_SESSION_BUS_ADDRESS at it.
+func startSessionBus(t *testing.T) {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not available")
+	}
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "session.conf")
+	err = os.WriteFile(config, []byte(`<!DOCTYPE busconfig PUBLIC
+ "-//freedesktop//DTD D-BUS Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:dir=`+dir+`</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write bus config: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, daemon, "--nofork", "--print-address", "--config-file="+config)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		_ = cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read bus address: %v", err)
+	}
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", strings.TrimSpace(address))
+}
+
+// fakeSecretService is a minimal in-process Secret Service: one always
+// unlocked collection, plain sessions and no prompts.
+type fakeSecretService struct {
+	conn *dbus.Conn
+
+	mu    sync.Mutex
+	items map[dbus.ObjectPath]*fakeSecretItem
+	next  int
+}
+
+type fakeSecretItem struct {
+	attrs map[string]string
+	value []byte
+}
+
+func newFakeSecretService(t *testing.T) *fakeSecretService {
+	t.Helper()
+	startSessionBus(t)
+
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatalf("failed to connect to test bus: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	f := &fakeSecretService{conn: conn, items: make(map[dbus.ObjectPath]*fakeSecretItem)}
+	if err := conn.Export(f, secretServicePath, secretServiceIface); err != nil {
+		t.Fatalf("failed to export service: %v", err)
+	}
+	err = conn.Export(fakeCollection{f}, secretDefaultCollection, secretCollectionIface)
+	if err != nil {
+		t.Fatalf("failed to export collection: %v", err)
+	}
+	reply, err := conn.RequestName(secretServiceName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own %s: %v", secretServiceName, err)
+	}
+	return f
+}
+
+func (f *fakeSecretService) OpenSession(
+	algorithm string,
+	_ dbus.Variant,
+) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != "plain" {
+		err := fmt.Errorf("unsupported algorithm %q", algorithm)
+		return dbus.Variant{}, "", dbus.MakeFailedError(err)
+	}
+	path := dbus.ObjectPath("/org/freedesktop/secrets/session/1")
+	if err := f.conn.Export(fakeSession{}, path, secretSessionIface); err != nil {
+		return dbus.Variant{}, "", dbus.MakeFailedError(err)
+	}
+	return dbus.MakeVariant(""), path, nil
+}
+
+func (f *fakeSecretService) SearchItems(
+	attrs map[string]string,
+) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	unlocked := []dbus.ObjectPath{}
+	for path, item := range f.items {
+		if matchAttrs(item.attrs, attrs) {
+			unlocked = append(unlocked, path)
+		}
+	}
+	return unlocked, []dbus.ObjectPath{}, nil
+}
+
+func (f *fakeSecretService) Unlock(
+	objects []dbus.ObjectPath,
+) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	return objects, noPrompt, nil
+}
+
+func (f *fakeSecretService) GetSecrets(
+	items []dbus.ObjectPath,
+	session dbus.ObjectPath,
+) (map[dbus.ObjectPath]secret, *dbus.Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	secrets := make(map[dbus.ObjectPath]secret, len(items))
+	for _, path := range items {
+		if item, ok := f.items[path]; ok {
+			secrets[path] = secret{
+				Session:     session,
+				Parameters:  []byte{},
+				Value:       item.value,
+				ContentType: "application/json",
+			}
+		}
+	}
+	return secrets, nil
+}
+
+// count returns the number of stored items.
+func (f *fakeSecretService) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.items)
+}
+
+func matchAttrs(have, want map[string]string) bool {
+	for k, v := range want {
+		if have[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+type fakeSession struct{}
+
+func (fakeSession) Close() *dbus.Error { return nil }
+
+type fakeCollection struct{ f *fakeSecretService }
+
+func (c fakeCollection) CreateItem(
+	props map[string]dbus.Variant,
+	sec secret,
+	replace bool,
+) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	attrs, _ := props[secretItemIface+".Attributes"].Value().(map[string]string)
+
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+
+	if replace {
+		for path, item := range c.f.items {
+			if maps.Equal(item.attrs, attrs) {
+				item.value = sec.Value
+				return path, noPrompt, nil
+			}
+		}
+	}
+	c.f.next++
+	path := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/collection/login/%d", c.f.next))
+	c.f.items[path] = &fakeSecretItem{attrs: attrs, value: sec.Value}
+
+	obj := fakeItem{f: c.f, path: path}
+	if err := c.f.conn.Export(obj, path, secretItemIface); err != nil {
+		return "", "", dbus.MakeFailedError(err)
+	}
+	if err := c.f.conn.Export(obj, path, "org.freedesktop.DBus.Properties"); err != nil {
+		return "", "", dbus.MakeFailedError(err)
+	}
+	return path, noPrompt, nil
+}
+
+type fakeItem struct {
+	f    *fakeSecretService
+	path dbus.ObjectPath
+}
+
+func (i fakeItem) Delete() (dbus.ObjectPath, *dbus.Error) {
+	i.f.mu.Lock()
+	defer i.f.mu.Unlock()
+	delete(i.f.items, i.path)
+	return noPrompt, nil
+}
+
+func (i fakeItem) Get(iface, name string) (dbus.Variant, *dbus.Error) {
+	i.f.mu.Lock()
+	defer i.f.mu.Unlock()
+
+	item, ok := i.f.items[i.path]
+	if !ok || iface != secretItemIface || name != "Attributes" {
+		return dbus.Variant{}, dbus.MakeFailedError(errors.New("no such property"))
+	}
+	return dbus.MakeVariant(item.attrs), nil
+}
+
+func TestSecretServiceStore(t *testing.T) {
+	fake := newFakeSecretService(t)
+	store := &SecretServiceStore{LockPath: filepath.Join(t.TempDir(), "keyring")}
+
+	if _, err := store.Load(); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("Load() on empty keyring error = %v, want fs.ErrNotExist", err)
+	}
+
+	c := newTestClient(t)
+	c.Store = store
+	saveTestTokens(t, c, c.ClientID, "other-client")
+	if got := fake.count(); got != 2 {
+		t.Fatalf("keyring holds %d items, want 2", got)
+	}
+
+	// Saving again replaces the item instead of adding one.
+	if err := c.SaveTokens(&TokenStorage{
+		AccessToken: "rotated-access",
+		TokenType:   "Bearer",
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("SaveTokens() error = %v", err)
+	}
+	if got := fake.count(); got != 2 {
+		t.Errorf("keyring holds %d items after update, want 2", got)
+	}
+
+	storage, err := c.LoadTokens()
+	if err != nil {
+		t.Fatalf("LoadTokens() error = %v", err)
+	}
+	if storage.AccessToken != "rotated-access" {
+		t.Errorf("AccessToken = %q, want rotated-access", storage.AccessToken)
+	}
+
+	removed, err := c.DeleteTokens()
+	if err != nil || !removed {
+		t.Fatalf("DeleteTokens() = %v, %v; want true, nil", removed, err)
+	}
+	if got := fake.count(); got != 1 {
+		t.Errorf("keyring holds %d items after delete, want 1", got)
+	}
+	if _, err := c.LoadTokens(); !errors.Is(err, ErrNoTokens) {
+		t.Errorf("LoadTokens() after delete error = %v, want ErrNoTokens", err)
+	}
+}
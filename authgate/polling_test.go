@@ -1,4 +1,4 @@
-package main
+package authgate
 
 import (
 	"context"
@@ -10,7 +10,6 @@ import (
 	"testing"
 	"time"
 
-	"github.com/go-authgate/device-cli/tui"
 	"golang.org/x/oauth2"
 )
 
@@ -58,7 +57,9 @@ func TestPollForToken_AuthorizationPending(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	token, err := pollForTokenWithProgress(ctx, config, deviceAuth, tui.NoopDisplayer{})
+	token, err := newTestClient(t).pollForTokenWithProgress(
+		ctx, config, deviceAuth, noopDisplayer{},
+	)
 	if err != nil {
 		t.Fatalf("Expected success, got error: %v", err)
 	}
@@ -128,7 +129,9 @@ func TestPollForToken_SlowDown(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	token, err := pollForTokenWithProgress(ctx, config, deviceAuth, tui.NoopDisplayer{})
+	token, err := newTestClient(t).pollForTokenWithProgress(
+		ctx, config, deviceAuth, noopDisplayer{},
+	)
 	if err != nil {
 		t.Fatalf("Expected success, got error: %v", err)
 	}
@@ -200,7 +203,9 @@ func TestPollForToken_ErrorCases(t *testing.T) {
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
 
-			_, err := pollForTokenWithProgress(ctx, config, deviceAuth, tui.NoopDisplayer{})
+			_, err := newTestClient(t).pollForTokenWithProgress(
+				ctx, config, deviceAuth, noopDisplayer{},
+			)
 			if err == nil {
 				t.Fatalf("Expected error for %s, got nil", tt.name)
 			}
@@ -240,7 +245,9 @@ func TestPollForToken_ContextTimeout(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	_, err := pollForTokenWithProgress(ctx, config, deviceAuth, tui.NoopDisplayer{})
+	_, err := newTestClient(t).pollForTokenWithProgress(
+		ctx, config, deviceAuth, noopDisplayer{},
+	)
 	if err == nil {
 		t.Fatal("Expected context timeout error, got nil")
 	}
@@ -278,12 +285,15 @@ func TestExchangeDeviceCode_Success(t *testing.T) {
 			"refresh_token": "test-refresh-token",
 			"token_type":    "Bearer",
 			"expires_in":    3600,
+			"scope":         "read",
 		})
 	}))
 	defer server.Close()
 
 	ctx := context.Background()
-	token, err := exchangeDeviceCode(ctx, server.URL, "test-client", "test-device-code")
+	token, err := newTestClient(t).exchangeDeviceCode(
+		ctx, server.URL, "test-client", "test-device-code",
+	)
 	if err != nil {
 		t.Fatalf("Expected success, got error: %v", err)
 	}
@@ -299,4 +309,8 @@ func TestExchangeDeviceCode_Success(t *testing.T) {
 	if token.TokenType != "Bearer" {
 		t.Errorf("Expected token type 'Bearer', got '%s'", token.TokenType)
 	}
+
+	if scope, _ := token.Extra("scope").(string); scope != "read" {
+		t.Errorf("Expected scope 'read', got '%s'", scope)
+	}
 }
@@ -0,0 +1,233 @@
+package authgate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RefreshAccessToken refreshes the access token using refresh token and saves
+// the result. Returns ErrRefreshTokenExpired when the server rejects the
+// refresh token.
+//
+// The saved tokens are re-read and replaced in one transaction, so when
+// several processes refresh at once exactly one contacts the server and the
+// others wait for the lock and return its result. A refresh token that was
+// already exchanged is never sent again: if the saved tokens were refreshed
+// since refreshToken was loaded, a result valid for longer than c.RefreshAhead
+// is returned as is and any other is refreshed with the newer refresh token.
+//
+// When the lock cannot be taken at all, as in a read-only token directory,
+// the refresh goes ahead without it and the save failure is reported to d.
+func (c *Client) RefreshAccessToken(
+	ctx context.Context,
+	refreshToken string,
+	d Displayer,
+) (*TokenStorage, error) {
+	var (
+		locked    bool
+		refreshed *TokenStorage
+	)
+	err := c.updateTokensWait(ctx, func(tx *TokenTx) error {
+		locked = true
+		saved, _ := tx.Get()
+		storage, err := c.refreshSaved(ctx, refreshToken, saved, d)
+		if err != nil {
+			return err
+		}
+		refreshed = storage
+		if storage != saved {
+			tx.Put(storage)
+		}
+		return nil
+	})
+	if !locked && isLockUnavailable(err) {
+		saved, _ := c.loadTokens(ctx)
+		storage, refreshErr := c.refreshSaved(ctx, refreshToken, saved, d)
+		if refreshErr != nil {
+			return nil, refreshErr
+		}
+		d.TokenSaveFailed(err)
+		return storage, nil
+	}
+	if err != nil {
+		// The refresh succeeded but could not be saved
+		if refreshed != nil {
+			d.TokenSaveFailed(err)
+			return refreshed, nil
+		}
+		return nil, err
+	}
+
+	return refreshed, nil
+}
+
+// refreshSaved refreshes the tokens saved as saved, which may be nil, whose
+// caller loaded refreshToken. It returns saved itself when another process
+// already refreshed it and the result is valid for longer than c.RefreshAhead.
+func (c *Client) refreshSaved(
+	ctx context.Context,
+	refreshToken string,
+	saved *TokenStorage,
+	d Displayer,
+) (*TokenStorage, error) {
+	prev := &TokenStorage{}
+	if saved != nil {
+		if saved.RefreshToken != refreshToken && saved.Valid(c.refreshAhead()) {
+			return saved, nil
+		}
+		prev = saved
+	}
+	return c.requestRefresh(ctx, firstNonEmpty(prev.RefreshToken, refreshToken), prev, d)
+}
+
+// updateTokensWait runs UpdateTokens, waiting out lock timeouts with
+// waitForLock. Refreshes hold the lock across a network round trip that can
+// outlast the lock timeout, and a process waiting for another's refresh must
+// pick up its result rather than fail.
+func (c *Client) updateTokensWait(ctx context.Context, fn func(tx *TokenTx) error) error {
+	return waitForLock(ctx, func() error {
+		return c.updateTokens(ctx, fn)
+	})
+}
+
+// loadTokensWait runs LoadTokens, waiting out lock timeouts with waitForLock.
+func (c *Client) loadTokensWait(ctx context.Context) (*TokenStorage, error) {
+	var storage *TokenStorage
+	err := waitForLock(ctx, func() error {
+		var err error
+		storage, err = c.loadTokens(ctx)
+		return err
+	})
+	return storage, err
+}
+
+// waitForLock calls fn again while it fails with ErrLockTimeout, for up to
+// refreshLockWait or until ctx is done.
+func waitForLock(ctx context.Context, fn func() error) error {
+	deadline := time.Now().Add(refreshLockWait)
+	for {
+		err := fn()
+		if !errors.Is(err, ErrLockTimeout) || ctx.Err() != nil || time.Now().After(deadline) {
+			return err
+		}
+	}
+}
+
+// requestRefresh exchanges refreshToken for new tokens without saving them.
+// The scope and ID token of prev, the tokens being replaced, are kept when the
+// server omits them. A new ID token that fails verification is dropped along
+// with the previous one and reported to d rather than failing the refresh, as
+// the server may already have rotated the refresh token.
+func (c *Client) requestRefresh(
+	ctx context.Context,
+	refreshToken string,
+	prev *TokenStorage,
+	d Displayer,
+) (*TokenStorage, error) {
+	// Create request with timeout
+	reqCtx, cancel := context.WithTimeout(ctx, refreshTokenTimeout)
+	defer cancel()
+
+	data := url.Values{}
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", refreshToken)
+	data.Set("client_id", c.ClientID)
+
+	req, err := http.NewRequestWithContext(
+		reqCtx,
+		http.MethodPost,
+		c.endpoints(ctx).TokenEndpoint,
+		strings.NewReader(data.Encode()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Execute request with retry logic
+	resp, err := c.do(reqCtx, req)
+	if err != nil {
+		return nil, fmt.Errorf("refresh request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	skew := serverClockSkew(resp.Header, time.Now())
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ErrorResponse
+		if err := json.Unmarshal(body, &errResp); err == nil {
+			// Check if refresh token is expired or invalid
+			if errResp.Error == "invalid_grant" || errResp.Error == "invalid_token" {
+				return nil, ErrRefreshTokenExpired
+			}
+			return nil, fmt.Errorf("%s: %s", errResp.Error, errResp.ErrorDescription)
+		}
+		return nil, fmt.Errorf("refresh failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	// Parse token response
+	var tokenResp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		Scope        string `json:"scope"`
+		IDToken      string `json:"id_token"`
+	}
+
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to parse token response: %w", err)
+	}
+
+	// Validate token response
+	if err := validateTokenResponse(
+		tokenResp.AccessToken,
+		tokenResp.TokenType,
+		tokenResp.ExpiresIn,
+	); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+
+	// Handle refresh token rotation modes:
+	// - Rotation mode: Server returns new refresh_token (use it)
+	// - Fixed mode: Server doesn't return refresh_token (preserve old one)
+	newRefreshToken := tokenResp.RefreshToken
+	if newRefreshToken == "" {
+		// Server didn't return a new refresh token (fixed mode)
+		newRefreshToken = refreshToken
+	}
+
+	// A refreshed ID token has no nonce to check (OpenID Connect Core 12.2)
+	idToken := firstNonEmpty(tokenResp.IDToken, prev.IDToken)
+	if tokenResp.IDToken != "" {
+		if _, err := c.VerifyIDToken(ctx, tokenResp.IDToken, "", skew); err != nil {
+			d.IDTokenRejected(err)
+			idToken = ""
+		}
+	}
+
+	storage := &TokenStorage{
+		AccessToken:  tokenResp.AccessToken,
+		RefreshToken: newRefreshToken,
+		TokenType:    tokenResp.TokenType,
+		ExpiresAt:    time.Now().Add(skew + time.Duration(tokenResp.ExpiresIn)*time.Second),
+		ClientID:     c.ClientID,
+		Issuer:       c.issuer(),
+		Scope:        firstNonEmpty(tokenResp.Scope, prev.Scope),
+		IDToken:      idToken,
+		ClockSkew:    skew,
+	}
+
+	return storage, nil
+}
@@ -0,0 +1,274 @@
+package authgate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRefreshHelperProcess is the refresher started by
+// TestRefreshAccessToken_ConcurrentProcesses. It prints the access token it
+// obtained and exits.
+func TestRefreshHelperProcess(t *testing.T) {
+	if os.Getenv("AUTHGATE_REFRESH_HELPER") != "1" {
+		t.Skip("only runs as a helper process")
+	}
+
+	c := &Client{
+		ServerURL: os.Getenv("AUTHGATE_SERVER_URL"),
+		ClientID:  "test-client",
+		Store: &FileStore{
+			Path: os.Getenv("AUTHGATE_TOKEN_FILE"),
+			// Shorter than the server's delay, so waiters time out on the
+			// lock at least once while the refresh is in flight.
+			LockTimeout: 100 * time.Millisecond,
+		},
+	}
+	storage, err := c.FreshToken(context.Background(), DefaultRefreshAhead, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Print(storage.AccessToken)
+	os.Exit(0)
+}
+
+func TestRefreshAccessToken_ConcurrentProcesses(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts helper processes")
+	}
+
+	var refreshCalls atomic.Int32
+	server := newRotatingServer(t, &refreshCalls, 500*time.Millisecond)
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	if err := c.SaveTokens(&TokenStorage{
+		AccessToken:  "expired-access-token",
+		RefreshToken: "initial-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+		Scope:        "read write",
+	}); err != nil {
+		t.Fatalf("SaveTokens() error = %v", err)
+	}
+
+	const processes = 8
+	outputs := make([]string, processes)
+	var wg sync.WaitGroup
+	for i := range processes {
+		wg.Go(func() {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestRefreshHelperProcess$")
+			cmd.Env = append(os.Environ(),
+				"AUTHGATE_REFRESH_HELPER=1",
+				"AUTHGATE_SERVER_URL="+server.URL,
+				"AUTHGATE_TOKEN_FILE="+c.TokenFile,
+			)
+			var stderr strings.Builder
+			cmd.Stderr = &stderr
+			out, err := cmd.Output()
+			if err != nil {
+				t.Errorf("refresher %d: %v: %s", i, err, stderr.String())
+			}
+			outputs[i] = string(out)
+		})
+	}
+	wg.Wait()
+
+	// A second call would either refresh needlessly or reuse a rotated token.
+	if got := refreshCalls.Load(); got != 1 {
+		t.Errorf("refresh calls = %d, want 1", got)
+	}
+	for i, out := range outputs {
+		if out != "rotated-access-token-1" {
+			t.Errorf("refresher %d got access token %q, want rotated-access-token-1", i, out)
+		}
+	}
+
+	saved, err := c.LoadTokens()
+	if err != nil {
+		t.Fatalf("LoadTokens() error = %v", err)
+	}
+	if saved.RefreshToken != "rotated-refresh-token-1" {
+		t.Errorf("saved refresh token = %q, want rotated-refresh-token-1", saved.RefreshToken)
+	}
+}
+
+func TestRefreshAccessToken_StaleRefreshToken(t *testing.T) {
+	var refreshCalls atomic.Int32
+	server := newRotatingServer(t, &refreshCalls, 0)
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	if err := c.SaveTokens(&TokenStorage{
+		AccessToken:  "expired-access-token",
+		RefreshToken: "initial-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+	}); err != nil {
+		t.Fatalf("SaveTokens() error = %v", err)
+	}
+
+	// The caller loaded its refresh token before another process rotated it.
+	storage, err := c.RefreshAccessToken(
+		context.Background(), "used-refresh-token", noopDisplayer{},
+	)
+	if err != nil {
+		t.Fatalf("RefreshAccessToken() error = %v", err)
+	}
+	if storage.AccessToken != "rotated-access-token-1" {
+		t.Errorf("AccessToken = %q, want rotated-access-token-1", storage.AccessToken)
+	}
+	if got := refreshCalls.Load(); got != 1 {
+		t.Errorf("refresh calls = %d, want 1", got)
+	}
+}
+
+func TestRefreshAccessToken_LockWaitEndsWithContext(t *testing.T) {
+	var refreshCalls atomic.Int32
+	server := newRotatingServer(t, &refreshCalls, 0)
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	lock, err := acquireFileLock(context.Background(), c.TokenFile, 0)
+	if err != nil {
+		t.Fatalf("acquireFileLock() error = %v", err)
+	}
+	defer lock.release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = c.RefreshAccessToken(ctx, "initial-refresh-token", noopDisplayer{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RefreshAccessToken() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("RefreshAccessToken() waited %v after the context ended", elapsed)
+	}
+	if got := refreshCalls.Load(); got != 0 {
+		t.Errorf("refresh calls = %d, want 0", got)
+	}
+}
+
+// readOnlyStore is a MemoryStore whose updates fail as in a read-only
+// directory, where the lock file cannot be created.
+type readOnlyStore struct{ MemoryStore }
+
+func (s *readOnlyStore) Update(func(map[string]*TokenStorage) (bool, error)) error {
+	return fmt.Errorf("failed to acquire lock: %w", fs.ErrPermission)
+}
+
+// saveFailures records the errors reported by TokenSaveFailed.
+type saveFailures struct {
+	noopDisplayer
+	errs []error
+}
+
+func (d *saveFailures) TokenSaveFailed(err error) { d.errs = append(d.errs, err) }
+
+func TestRefreshAccessToken_WithoutLock(t *testing.T) {
+	var refreshCalls atomic.Int32
+	server := newRotatingServer(t, &refreshCalls, 0)
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	store := &readOnlyStore{}
+	err := store.MemoryStore.Update(func(tokens map[string]*TokenStorage) (bool, error) {
+		tokens[c.tokenKey()] = &TokenStorage{
+			AccessToken:  "expired-access-token",
+			RefreshToken: "initial-refresh-token",
+			ExpiresAt:    time.Now().Add(-time.Minute),
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Store = store
+
+	d := &saveFailures{}
+	storage, err := c.RefreshAccessToken(context.Background(), "initial-refresh-token", d)
+	if err != nil {
+		t.Fatalf("RefreshAccessToken() error = %v", err)
+	}
+	if storage.AccessToken != "rotated-access-token-1" || refreshCalls.Load() != 1 {
+		t.Errorf("AccessToken = %q after %d refreshes, want one refresh",
+			storage.AccessToken, refreshCalls.Load())
+	}
+	if len(d.errs) != 1 || !errors.Is(d.errs[0], fs.ErrPermission) {
+		t.Errorf("TokenSaveFailed() reported %v, want the lock error", d.errs)
+	}
+}
+
+func TestRefreshAccessToken_KeepsIDToken(t *testing.T) {
+	var refreshCalls atomic.Int32
+	server := newRotatingServer(t, &refreshCalls, 0)
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	if err := c.SaveTokens(&TokenStorage{
+		AccessToken:  "expired-access-token",
+		RefreshToken: "initial-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+		IDToken:      "saved-id-token",
+	}); err != nil {
+		t.Fatalf("SaveTokens() error = %v", err)
+	}
+
+	// The server returns no ID token on refresh, so the saved one is kept.
+	storage, err := c.RefreshAccessToken(
+		context.Background(), "initial-refresh-token", noopDisplayer{},
+	)
+	if err != nil {
+		t.Fatalf("RefreshAccessToken() error = %v", err)
+	}
+	if storage.IDToken != "saved-id-token" {
+		t.Errorf("IDToken = %q, want saved-id-token", storage.IDToken)
+	}
+}
+
+func TestRefreshAccessToken_RecordsClockSkew(t *testing.T) {
+	const skew = 10 * time.Minute
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(skew).UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "skewed-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer server.Close()
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	storage, err := c.RefreshAccessToken(
+		context.Background(), "initial-refresh-token", noopDisplayer{},
+	)
+	if err != nil {
+		t.Fatalf("RefreshAccessToken() error = %v", err)
+	}
+
+	if d := storage.ClockSkew - skew; d.Abs() > time.Second {
+		t.Errorf("ClockSkew = %v, want about %v", storage.ClockSkew, skew)
+	}
+	if d := time.Until(storage.ExpiresAt) - (skew + time.Hour); d.Abs() > 2*time.Second {
+		t.Errorf("ExpiresAt = %v, want an hour after the server's time", storage.ExpiresAt)
+	}
+	if d := time.Until(storage.Expiry()) - time.Hour; d.Abs() > 2*time.Second {
+		t.Errorf("Expiry() = %v, want an hour from now", storage.Expiry())
+	}
+}
@@ -0,0 +1,182 @@
+package authgate
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Token type hints for RFC 7009 revocation requests
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// RevokeToken asks the server to revoke token as described in RFC 7009. hint
+// is sent as token_type_hint and may be empty. The server answers 200 for
+// tokens that are already invalid, so a nil error means the token is no
+// longer usable.
+func (c *Client) RevokeToken(ctx context.Context, token, hint string) error {
+	return c.revoke(ctx, c.ClientID, token, hint)
+}
+
+// revoke sends one revocation request on behalf of clientID.
+func (c *Client) revoke(ctx context.Context, clientID, token, hint string) error {
+	// Create request with timeout
+	reqCtx, cancel := context.WithTimeout(ctx, revocationTimeout)
+	defer cancel()
+
+	data := url.Values{}
+	data.Set("token", token)
+	if hint != "" {
+		data.Set("token_type_hint", hint)
+	}
+	data.Set("client_id", clientID)
+
+	req, err := http.NewRequestWithContext(
+		reqCtx,
+		http.MethodPost,
+		c.endpoints(ctx).RevocationEndpoint,
+		strings.NewReader(data.Encode()),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Execute request with retry logic
+	resp, err := c.do(reqCtx, req)
+	if err != nil {
+		return fmt.Errorf("revocation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ErrorResponse
+		if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != "" {
+			return &RevocationError{ErrorResponse: errResp}
+		}
+		return fmt.Errorf("revocation failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// RevocationError is returned when the server rejects a revocation request.
+type RevocationError struct {
+	ErrorResponse
+}
+
+func (e *RevocationError) Error() string {
+	if e.ErrorDescription == "" {
+		return "revocation rejected: " + e.ErrorResponse.Error
+	}
+	return fmt.Sprintf("revocation rejected: %s: %s", e.ErrorResponse.Error, e.ErrorDescription)
+}
+
+// revokeStorage revokes the refresh token and, if it has not expired, the
+// access token of one saved entry. Servers that only revoke refresh tokens
+// answer unsupported_token_type for the access token, which is not an error:
+// the access token expires on its own and can no longer be refreshed.
+func (c *Client) revokeStorage(ctx context.Context, clientID string, s *TokenStorage) error {
+	if s.RefreshToken != "" {
+		if err := c.revoke(ctx, clientID, s.RefreshToken, TokenTypeHintRefreshToken); err != nil {
+			return err
+		}
+	}
+	if s.AccessToken == "" || !s.Valid(0) {
+		return nil
+	}
+	err := c.revoke(ctx, clientID, s.AccessToken, TokenTypeHintAccessToken)
+	var revErr *RevocationError
+	if errors.As(err, &revErr) && revErr.ErrorResponse.Error == "unsupported_token_type" {
+		return nil
+	}
+	return err
+}
+
+// Logout revokes the tokens saved for c.ServerURL and c.ClientID and removes
+// them from the token file, reporting whether an entry existed. The entry is
+// only removed once the server has confirmed the revocation; on error it is
+// kept so that logout can be retried. The file lock is held throughout so
+// that a concurrent refresh cannot save a token that was never revoked.
+func (c *Client) Logout(ctx context.Context) (bool, error) {
+	var removed bool
+	err := c.UpdateTokens(func(tx *TokenTx) error {
+		storage, ok := tx.Get()
+		if !ok {
+			return nil
+		}
+		if err := c.revokeStorage(ctx, c.ClientID, storage); err != nil {
+			return err
+		}
+		removed = tx.Delete()
+		return nil
+	})
+	return removed, err
+}
+
+// LogoutAll revokes and removes the tokens of every client in the token file
+// and returns the entries that were removed, ordered by issuer and client ID.
+// Each entry is revoked at the server that issued it. Entries whose
+// revocation fails are kept, and their errors are joined in the returned
+// error.
+func (c *Client) LogoutAll(ctx context.Context) ([]*TokenStorage, error) {
+	var (
+		removed []*TokenStorage
+		errs    []error
+	)
+	err := c.modifyTokens(ctx, func(tokens map[string]*TokenStorage) (bool, error) {
+		for key, storage := range tokens {
+			clientID := firstNonEmpty(storage.ClientID, key)
+			err := c.forIssuer(storage.Issuer).revokeStorage(ctx, clientID, storage)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("client_id %s: %w", clientID, err))
+				continue
+			}
+			delete(tokens, key)
+			removed = append(removed, storage)
+		}
+		return len(removed) > 0, nil
+	})
+	sortByIssuer(removed)
+	if err != nil {
+		return removed, err
+	}
+	return removed, errors.Join(errs...)
+}
+
+// sortByIssuer orders entries by issuer and then client ID.
+func sortByIssuer(entries []*TokenStorage) {
+	slices.SortFunc(entries, func(a, b *TokenStorage) int {
+		return cmp.Or(strings.Compare(a.Issuer, b.Issuer), strings.Compare(a.ClientID, b.ClientID))
+	})
+}
+
+// forIssuer returns a client for the server that issued a saved entry, or c
+// itself when issuer is empty or c's own server.
+func (c *Client) forIssuer(issuer string) *Client {
+	if issuer == "" || issuer == c.issuer() {
+		return c
+	}
+	peer := *c
+	peer.ServerURL = issuer
+	peer.Metadata = nil
+	peer.MetadataCacheFile = ""
+	if c.MetadataCacheFile != "" {
+		peer.MetadataCacheFile = DefaultMetadataCachePath(issuer)
+	}
+	return &peer
+}
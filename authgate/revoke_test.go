@@ -0,0 +1,155 @@
+package authgate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// revocationRecorder is a revocation endpoint that records the tokens it
+// receives. Requests from clients listed in reject are refused.
+type revocationRecorder struct {
+	mu      sync.Mutex
+	revoked []string // "hint:token"
+	reject  map[string]bool
+}
+
+func (rr *revocationRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != defaultRevocationPath {
+		http.NotFound(w, r)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rr.reject[r.PostForm.Get("client_id")] {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid_client"})
+		return
+	}
+	hint := r.PostForm.Get("token_type_hint")
+	if hint == TokenTypeHintAccessToken {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(ErrorResponse{Error: "unsupported_token_type"})
+		return
+	}
+
+	rr.mu.Lock()
+	rr.revoked = append(rr.revoked, hint+":"+r.PostForm.Get("token"))
+	rr.mu.Unlock()
+}
+
+func saveTestTokens(t *testing.T, c *Client, clientIDs ...string) {
+	t.Helper()
+	for _, id := range clientIDs {
+		if err := c.SaveTokens(&TokenStorage{
+			AccessToken:  "access-" + id,
+			RefreshToken: "refresh-" + id,
+			TokenType:    "Bearer",
+			ExpiresAt:    time.Now().Add(time.Hour),
+			ClientID:     id,
+		}); err != nil {
+			t.Fatalf("SaveTokens(%s) error = %v", id, err)
+		}
+	}
+}
+
+func TestLogout_RevokesBeforeRemoving(t *testing.T) {
+	rr := &revocationRecorder{}
+	server := httptest.NewServer(rr)
+	defer server.Close()
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	saveTestTokens(t, c, c.ClientID, "other-client")
+
+	removed, err := c.Logout(context.Background())
+	if err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+	if !removed {
+		t.Error("Logout() reported nothing removed")
+	}
+	// unsupported_token_type for the access token is tolerated.
+	if want := []string{"refresh_token:refresh-test-client"}; !slices.Equal(rr.revoked, want) {
+		t.Errorf("revoked = %v, want %v", rr.revoked, want)
+	}
+
+	if _, err := c.LoadTokens(); !errors.Is(err, ErrNoTokens) {
+		t.Errorf("LoadTokens() after logout error = %v, want ErrNoTokens", err)
+	}
+	other := *c
+	other.ClientID = "other-client"
+	if _, err := other.LoadTokens(); err != nil {
+		t.Errorf("other client's tokens were removed: %v", err)
+	}
+
+	removed, err = c.Logout(context.Background())
+	if err != nil || removed {
+		t.Errorf("second Logout() = %v, %v; want false, nil", removed, err)
+	}
+}
+
+func TestLogout_KeepsTokensWhenRevocationFails(t *testing.T) {
+	c := newTestClient(t)
+	rr := &revocationRecorder{reject: map[string]bool{c.ClientID: true}}
+	server := httptest.NewServer(rr)
+	defer server.Close()
+
+	c.ServerURL = server.URL
+	saveTestTokens(t, c, c.ClientID)
+
+	removed, err := c.Logout(context.Background())
+	var revErr *RevocationError
+	if !errors.As(err, &revErr) {
+		t.Fatalf("Logout() error = %v, want *RevocationError", err)
+	}
+	if removed {
+		t.Error("Logout() reported removal despite failed revocation")
+	}
+	if _, err := c.LoadTokens(); err != nil {
+		t.Errorf("tokens were removed despite failed revocation: %v", err)
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	rr := &revocationRecorder{reject: map[string]bool{"client-b": true}}
+	server := httptest.NewServer(rr)
+	defer server.Close()
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	saveTestTokens(t, c, "client-a", "client-b", "client-c")
+
+	removed, err := c.LogoutAll(context.Background())
+	if err == nil {
+		t.Error("LogoutAll() expected error for rejected client")
+	}
+	var removedIDs []string
+	for _, s := range removed {
+		removedIDs = append(removedIDs, s.ClientID)
+	}
+	if want := []string{"client-a", "client-c"}; !slices.Equal(removedIDs, want) {
+		t.Errorf("removed = %v, want %v", removedIDs, want)
+	}
+
+	kept := *c
+	kept.ClientID = "client-b"
+	if _, err := kept.LoadTokens(); err != nil {
+		t.Errorf("client-b tokens were removed despite failed revocation: %v", err)
+	}
+	for _, id := range removedIDs {
+		gone := *c
+		gone.ClientID = id
+		if _, err := gone.LoadTokens(); !errors.Is(err, ErrNoTokens) {
+			t.Errorf("LoadTokens(%s) error = %v, want ErrNoTokens", id, err)
+		}
+	}
+}
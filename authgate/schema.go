@@ -0,0 +1,143 @@
+package authgate
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// TokenFileVersion is the token file schema version written by this package.
+//
+// Version history:
+//
+//	0: no version field; entries keyed by client ID
+//	1: entries keyed by TokenKey (server URL and client ID)
+const TokenFileVersion = 1
+
+// tokenFileMigrations[i] upgrades a decoded token file from version i to
+// i+1. Each step runs in order until the file reaches TokenFileVersion.
+var tokenFileMigrations = []func(m *TokenStorageMap) error{
+	// 0 -> 1: a version 0 file does not record which server issued an
+	// entry, so entries keyed by client ID alone are kept as they are and
+	// claimed by the first client that reads them (see migrateLegacy).
+	func(*TokenStorageMap) error { return nil },
+}
+
+// decodeTokenFile parses a plaintext token file and upgrades it to
+// TokenFileVersion. Files written by a newer version keep their version
+// number and unknown fields, so rewriting them does not lose data.
+func decodeTokenFile(data []byte) (*TokenStorageMap, error) {
+	var storageMap TokenStorageMap
+	if err := json.Unmarshal(data, &storageMap); err != nil {
+		return nil, err
+	}
+	for v := storageMap.Version; v < len(tokenFileMigrations); v++ {
+		if err := tokenFileMigrations[v](&storageMap); err != nil {
+			return nil, err
+		}
+		storageMap.Version = v + 1
+	}
+	return &storageMap, nil
+}
+
+// tokenStorageMapJSON and tokenStorageJSON have the fields but not the
+// methods of the types they convert, so they use the default JSON encoding.
+type (
+	tokenStorageMapJSON TokenStorageMap
+	tokenStorageJSON    TokenStorage
+)
+
+// UnmarshalJSON decodes the token file and keeps any unknown fields.
+func (m *TokenStorageMap) UnmarshalJSON(data []byte) error {
+	extra, err := unmarshalWithExtra(data, (*tokenStorageMapJSON)(m))
+	m.extra = extra
+	return err
+}
+
+// MarshalJSON encodes the token file including any unknown fields it was
+// decoded with.
+func (m *TokenStorageMap) MarshalJSON() ([]byte, error) {
+	return marshalWithExtra((*tokenStorageMapJSON)(m), m.extra)
+}
+
+// UnmarshalJSON decodes an entry and keeps any unknown fields.
+func (s *TokenStorage) UnmarshalJSON(data []byte) error {
+	extra, err := unmarshalWithExtra(data, (*tokenStorageJSON)(s))
+	s.extra = extra
+	return err
+}
+
+// MarshalJSON encodes an entry including any unknown fields it was decoded
+// with.
+func (s *TokenStorage) MarshalJSON() ([]byte, error) {
+	return marshalWithExtra((*tokenStorageJSON)(s), s.extra)
+}
+
+// unmarshalWithExtra decodes data into known, a pointer to a struct, and
+// returns the object members that known has no field for.
+func unmarshalWithExtra(data []byte, known any) (map[string]json.RawMessage, error) {
+	if err := json.Unmarshal(data, known); err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	fields := jsonFieldNames(reflect.TypeOf(known).Elem())
+	for name := range all {
+		if fields[name] {
+			delete(all, name)
+		}
+	}
+	if len(all) == 0 {
+		return nil, nil
+	}
+	return all, nil
+}
+
+// marshalWithExtra encodes known and adds the members of extra that known
+// does not set itself.
+func marshalWithExtra(known any, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(known)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	for name, value := range extra {
+		if _, ok := all[name]; !ok {
+			all[name] = value
+		}
+	}
+	return json.Marshal(all)
+}
+
+// fieldNames caches jsonFieldNames per type.
+var fieldNames sync.Map // reflect.Type -> map[string]bool
+
+// jsonFieldNames returns the JSON member names of struct type t.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	if names, ok := fieldNames.Load(t); ok {
+		return names.(map[string]bool)
+	}
+	names := make(map[string]bool, t.NumField())
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = true
+	}
+	fieldNames.Store(t, names)
+	return names
+}
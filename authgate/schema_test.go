@@ -0,0 +1,105 @@
+package authgate
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readTokenFile(t *testing.T, path string) map[string]any {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read token file: %v", err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("failed to parse token file: %v", err)
+	}
+	return raw
+}
+
+func TestSaveTokens_WritesVersion(t *testing.T) {
+	c := newTestClient(t)
+	saveTestTokens(t, c, c.ClientID)
+
+	raw := readTokenFile(t, c.TokenFile)
+	if got := raw["version"]; got != float64(TokenFileVersion) {
+		t.Errorf("version = %v, want %d", got, TokenFileVersion)
+	}
+}
+
+func TestSaveTokens_PreservesUnknownFields(t *testing.T) {
+	c := newTestClient(t)
+	future := `{
+		"version": 99,
+		"default_account": "work",
+		"tokens": {
+			"https://other.example.com#other-client": {
+				"access_token": "other-access",
+				"client_id": "other-client",
+				"issuer": "https://other.example.com",
+				"dpop_key": {"kty": "EC"}
+			}
+		}
+	}`
+	if err := os.WriteFile(c.TokenFile, []byte(future), 0o600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+
+	saveTestTokens(t, c, c.ClientID)
+
+	raw := readTokenFile(t, c.TokenFile)
+	if raw["version"] != float64(99) {
+		t.Errorf("version = %v, want the newer version 99 kept", raw["version"])
+	}
+	if raw["default_account"] != "work" {
+		t.Errorf("unknown top-level field lost: %v", raw)
+	}
+	tokens, _ := raw["tokens"].(map[string]any)
+	other, _ := tokens["https://other.example.com#other-client"].(map[string]any)
+	if _, ok := other["dpop_key"]; !ok {
+		t.Errorf("unknown entry field lost: %v", other)
+	}
+	if _, ok := tokens[c.tokenKey()]; !ok {
+		t.Error("new entry was not saved")
+	}
+}
+
+func TestSaveTokens_BacksUpCorruptFile(t *testing.T) {
+	c := newTestClient(t)
+	corrupt := []byte(`{"tokens": {"test-client": {"access_token": "trunc`)
+	if err := os.WriteFile(c.TokenFile, corrupt, 0o600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+
+	saveTestTokens(t, c, c.ClientID)
+
+	backups, err := filepath.Glob(c.TokenFile + ".corrupt-*")
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("backups = %v (err %v), want exactly one", backups, err)
+	}
+	data, err := os.ReadFile(backups[0])
+	if err != nil || string(data) != string(corrupt) {
+		t.Errorf("backup content = %q, want the corrupt file", data)
+	}
+	if _, err := c.LoadTokens(); err != nil {
+		t.Errorf("LoadTokens() after recovery error = %v", err)
+	}
+}
+
+func TestDecodeTokenFile_MigratesVersion0(t *testing.T) {
+	m, err := decodeTokenFile(
+		[]byte(`{"tokens": {"abc": {"access_token": "x", "client_id": "abc"}}}`),
+	)
+	if err != nil {
+		t.Fatalf("decodeTokenFile() error = %v", err)
+	}
+	if m.Version != TokenFileVersion {
+		t.Errorf("Version = %d, want %d", m.Version, TokenFileVersion)
+	}
+	if m.Tokens["abc"] == nil {
+		t.Error("version 0 entry was dropped")
+	}
+}
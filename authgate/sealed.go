@@ -0,0 +1,210 @@
+package authgate
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// sealedFormat marks a token file sealed by FileStore.
+const sealedFormat = "authgate-sealed-v1"
+
+// Key derivation settings
+const (
+	kdfScrypt  = "scrypt"
+	kdfKeyFile = "key-file"
+	keySize    = 32 // AES-256
+	saltSize   = 16
+	scryptN    = 1 << 15
+	scryptR    = 8
+	scryptP    = 1
+)
+
+// ErrTokenFileEncrypted indicates that the token file is sealed and no key
+// was configured to open it.
+var ErrTokenFileEncrypted = errors.New("token file is encrypted")
+
+// sealedFile is the on-disk format of an encrypted token file. The
+// ciphertext is the plaintext token file sealed with AES-256-GCM.
+type sealedFile struct {
+	Sealed     string `json:"sealed"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// FileKey supplies the key that seals an encrypted token file: a raw key read
+// from KeyFile, or a key derived with scrypt from a passphrase. It is safe
+// for concurrent use.
+type FileKey struct {
+	// KeyFile holds a 32-byte key, raw or base64-encoded. It takes
+	// precedence over Passphrase.
+	KeyFile string
+	// Passphrase returns the passphrase the key is derived from. It is called
+	// at most once.
+	Passphrase func() ([]byte, error)
+
+	mu         sync.Mutex
+	passphrase []byte
+	salt       []byte
+	derived    []byte
+}
+
+// kdf returns how k derives its key.
+func (k *FileKey) kdf() string {
+	if k.KeyFile != "" {
+		return kdfKeyFile
+	}
+	return kdfScrypt
+}
+
+// key returns the key for a file sealed with kdf and salt.
+func (k *FileKey) key(kdf string, salt []byte) ([]byte, error) {
+	if kdf != k.kdf() {
+		return nil, fmt.Errorf(
+			"token file was sealed with a %s key, but a %s key is configured", kdf, k.kdf(),
+		)
+	}
+	if kdf == kdfKeyFile {
+		return readKeyFile(k.KeyFile)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.derived != nil && bytes.Equal(k.salt, salt) {
+		return k.derived, nil
+	}
+	if k.passphrase == nil {
+		if k.Passphrase == nil {
+			return nil, errors.New("no passphrase configured for encrypted token file")
+		}
+		passphrase, err := k.Passphrase()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		if len(passphrase) == 0 {
+			return nil, errors.New("passphrase is empty")
+		}
+		k.passphrase = passphrase
+	}
+	derived, err := scrypt.Key(k.passphrase, salt, scryptN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, err
+	}
+	k.salt, k.derived = salt, derived
+	return derived, nil
+}
+
+// sealingSalt returns the salt to seal with: the one last used to open or
+// seal a file, so the key need not be derived again, or a new random salt.
+func (k *FileKey) sealingSalt() ([]byte, error) {
+	if k.kdf() == kdfKeyFile {
+		return nil, nil
+	}
+	k.mu.Lock()
+	salt := k.salt
+	k.mu.Unlock()
+	if salt != nil {
+		return salt, nil
+	}
+	salt = make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// readKeyFile reads a raw or base64-encoded 32-byte key.
+func readKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if len(data) == keySize {
+		return data, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf(
+			"key file %s must hold %d bytes, raw or base64-encoded", path, keySize,
+		)
+	}
+	return key, nil
+}
+
+// seal encrypts plaintext into the sealed file format.
+func (k *FileKey) seal(plaintext []byte) ([]byte, error) {
+	salt, err := k.sealingSalt()
+	if err != nil {
+		return nil, err
+	}
+	key, err := k.key(k.kdf(), salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(sealedFile{
+		Sealed:     sealedFormat,
+		KDF:        k.kdf(),
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, []byte(sealedFormat)),
+	}, "", "  ")
+}
+
+// openSealed returns the plaintext of data. Files that are not sealed are
+// returned unchanged, so plaintext and encrypted token files can both be
+// read. k may be nil, in which case sealed files fail with
+// ErrTokenFileEncrypted.
+func openSealed(k *FileKey, data []byte) ([]byte, error) {
+	var sealed sealedFile
+	if err := json.Unmarshal(data, &sealed); err != nil || sealed.Sealed != sealedFormat {
+		return data, nil
+	}
+	if k == nil {
+		return nil, ErrTokenFileEncrypted
+	}
+	key, err := k.key(sealed.KDF, sealed.Salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce in encrypted token file")
+	}
+	plaintext, err := aead.Open(nil, sealed.Nonce, sealed.Ciphertext, []byte(sealedFormat))
+	if err != nil {
+		return nil, errors.New("failed to decrypt token file: wrong passphrase or key")
+	}
+	return plaintext, nil
+}
+
+// newAEAD returns AES-256-GCM for key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,101 @@
+package authgate
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func passphraseKey(passphrase string, calls *int) *FileKey {
+	return &FileKey{Passphrase: func() ([]byte, error) {
+		*calls++
+		return []byte(passphrase), nil
+	}}
+}
+
+func TestFileStore_EncryptedRoundTrip(t *testing.T) {
+	var calls int
+	c := newTestClient(t)
+	c.Store = &FileStore{Path: c.TokenFile, Key: passphraseKey("correct horse", &calls)}
+	saveTestTokens(t, c, c.ClientID, "other-client")
+
+	data, err := os.ReadFile(c.TokenFile)
+	if err != nil {
+		t.Fatalf("failed to read token file: %v", err)
+	}
+	if bytes.Contains(data, []byte("refresh-test-client")) {
+		t.Error("token file contains a plaintext refresh token")
+	}
+
+	storage, err := c.LoadTokens()
+	if err != nil {
+		t.Fatalf("LoadTokens() error = %v", err)
+	}
+	if storage.RefreshToken != "refresh-test-client" {
+		t.Errorf("RefreshToken = %q, want refresh-test-client", storage.RefreshToken)
+	}
+	if calls != 1 {
+		t.Errorf("passphrase requested %d times, want 1", calls)
+	}
+
+	// A fresh key with the wrong passphrase cannot open the file.
+	c.Store = &FileStore{Path: c.TokenFile, Key: passphraseKey("wrong", &calls)}
+	if _, err := c.LoadTokens(); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("LoadTokens() with wrong passphrase error = %v", err)
+	}
+}
+
+func TestFileStore_EncryptedWithoutKey(t *testing.T) {
+	var calls int
+	c := newTestClient(t)
+	c.Store = &FileStore{Path: c.TokenFile, Key: passphraseKey("secret", &calls)}
+	saveTestTokens(t, c, c.ClientID)
+	sealed, err := os.ReadFile(c.TokenFile)
+	if err != nil {
+		t.Fatalf("failed to read token file: %v", err)
+	}
+
+	c.Store = nil
+	if _, err := c.LoadTokens(); !errors.Is(err, ErrTokenFileEncrypted) {
+		t.Errorf("LoadTokens() error = %v, want ErrTokenFileEncrypted", err)
+	}
+	if _, err := c.DeleteTokens(); !errors.Is(err, ErrTokenFileEncrypted) {
+		t.Errorf("DeleteTokens() error = %v, want ErrTokenFileEncrypted", err)
+	}
+	after, err := os.ReadFile(c.TokenFile)
+	if err != nil || !bytes.Equal(after, sealed) {
+		t.Error("encrypted token file was modified without its key")
+	}
+}
+
+func TestFileStore_KeyFileSealsPlaintextFile(t *testing.T) {
+	c := newTestClient(t)
+	saveTestTokens(t, c, c.ClientID)
+
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x42}, keySize))
+	keyFile := filepath.Join(t.TempDir(), "token.key")
+	if err := os.WriteFile(keyFile, []byte(key+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	c.Store = &FileStore{Path: c.TokenFile, Key: &FileKey{KeyFile: keyFile}}
+
+	// The plaintext file is read, and sealed by the next update.
+	if _, err := c.LoadTokens(); err != nil {
+		t.Fatalf("LoadTokens() of plaintext file error = %v", err)
+	}
+	saveTestTokens(t, c, "other-client")
+	data, err := os.ReadFile(c.TokenFile)
+	if err != nil {
+		t.Fatalf("failed to read token file: %v", err)
+	}
+	if !bytes.Contains(data, []byte(sealedFormat)) {
+		t.Error("token file was not sealed by the update")
+	}
+	if _, err := c.LoadTokens(); err != nil {
+		t.Errorf("LoadTokens() of sealed file error = %v", err)
+	}
+}
@@ -0,0 +1,303 @@
+package authgate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// TokenStorage represents saved tokens for a specific client
+type TokenStorage struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	TokenType    string    `json:"token_type"`
+	ExpiresAt    time.Time `json:"expires_at"` // on the server's clock
+	ClientID     string    `json:"client_id"`
+	Issuer       string    `json:"issuer,omitempty"` // server URL the tokens were issued by
+	Scope        string    `json:"scope,omitempty"`  // space-separated scopes granted
+	IDToken      string    `json:"id_token,omitempty"`
+
+	// ClockSkew is how far the server's clock was ahead of the local clock
+	// when the tokens were issued, estimated from the Date response header.
+	ClockSkew time.Duration `json:"clock_skew,omitempty"`
+
+	extra map[string]json.RawMessage // fields written by newer versions
+}
+
+// Token converts the stored tokens to an *oauth2.Token. The ID token, if any,
+// is available as Extra("id_token").
+func (s *TokenStorage) Token() *oauth2.Token {
+	token := &oauth2.Token{
+		AccessToken:  s.AccessToken,
+		RefreshToken: s.RefreshToken,
+		TokenType:    s.TokenType,
+		Expiry:       s.Expiry(),
+	}
+	if s.IDToken != "" {
+		return token.WithExtra(map[string]any{"id_token": s.IDToken})
+	}
+	return token
+}
+
+// Expiry returns when the access token expires on the local clock: the exp
+// claim when it is a JWT, or ExpiresAt otherwise, corrected by ClockSkew.
+func (s *TokenStorage) Expiry() time.Time {
+	expiry := s.ExpiresAt
+	if t, err := ParseJWT(s.AccessToken); err == nil {
+		if exp, ok := t.Expiry(); ok {
+			expiry = exp
+		}
+	}
+	return expiry.Add(-s.ClockSkew)
+}
+
+// Valid reports whether the access token remains valid for longer than ahead.
+func (s *TokenStorage) Valid(ahead time.Duration) bool {
+	return time.Until(s.Expiry()) > ahead
+}
+
+// MissingScopes returns the entries of requested that were not granted. Tokens
+// saved before scopes were recorded have an empty Scope and are assumed to
+// cover any request.
+func (s *TokenStorage) MissingScopes(requested []string) []string {
+	if s.Scope == "" {
+		return nil
+	}
+	granted := strings.Fields(s.Scope)
+	var missing []string
+	for _, scope := range requested {
+		if !slices.Contains(granted, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// TokenStorageMap manages tokens for multiple clients
+type TokenStorageMap struct {
+	Version int                      `json:"version"`
+	Tokens  map[string]*TokenStorage `json:"tokens"` // key = TokenKey(issuer, client_id)
+
+	extra map[string]json.RawMessage // fields written by newer versions
+}
+
+// TokenKey returns the token file key for clientID's tokens issued by
+// serverURL. Keying by server as well as client keeps the tokens of a client
+// ID registered on several servers apart.
+func TokenKey(serverURL, clientID string) string {
+	return normalizeServerURL(serverURL) + "#" + clientID
+}
+
+// normalizeServerURL strips trailing slashes so equivalent server URLs
+// produce the same key.
+func normalizeServerURL(serverURL string) string {
+	return strings.TrimRight(serverURL, "/")
+}
+
+// issuer returns the value recorded in TokenStorage.Issuer for c.
+func (c *Client) issuer() string {
+	return normalizeServerURL(c.ServerURL)
+}
+
+// tokenKey returns the token file key for c's tokens.
+func (c *Client) tokenKey() string {
+	return TokenKey(c.ServerURL, c.ClientID)
+}
+
+// LoadTokens loads tokens from the token store for c.ServerURL and c.ClientID.
+// An entry written by a version that keyed tokens by client ID alone is
+// migrated to the current key on first read.
+func (c *Client) LoadTokens() (*TokenStorage, error) {
+	return c.loadTokens(context.Background())
+}
+
+// loadTokens is LoadTokens, ending a wait for the store's lock when ctx is done.
+func (c *Client) loadTokens(ctx context.Context) (*TokenStorage, error) {
+	tokens, err := c.loadStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if tokens == nil {
+		return nil, fmt.Errorf("%w in %s", ErrNoTokens, c.store())
+	}
+
+	// Look up token for current server and client_id
+	if storage, ok := tokens[c.tokenKey()]; ok {
+		return storage, nil
+	}
+
+	if _, ok := tokens[c.ClientID]; ok {
+		var storage *TokenStorage
+		err := c.modifyTokens(ctx, func(tokens map[string]*TokenStorage) (bool, error) {
+			storage = tokens[c.tokenKey()]
+			return false, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate token file: %w", err)
+		}
+		if storage != nil {
+			return storage, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w for client_id: %s", ErrNoTokens, c.ClientID)
+}
+
+// migrateLegacy moves a legacy entry keyed by c.ClientID alone to c's
+// current key, recording c's server as its issuer. Legacy files do not say
+// which server issued a token, so the first client to read the entry claims
+// it. It reports whether tokens changed.
+func (c *Client) migrateLegacy(tokens map[string]*TokenStorage) bool {
+	legacy, ok := tokens[c.ClientID]
+	if !ok || legacy.Issuer != "" {
+		return false
+	}
+	delete(tokens, c.ClientID)
+	if _, exists := tokens[c.tokenKey()]; !exists {
+		legacy.ClientID = c.ClientID
+		legacy.Issuer = c.issuer()
+		tokens[c.tokenKey()] = legacy
+	}
+	return true
+}
+
+// SaveTokens saves tokens to file (merges with existing tokens for other clients)
+// Uses file locking to prevent race conditions when multiple processes access the same file
+func (c *Client) SaveTokens(storage *TokenStorage) error {
+	return c.UpdateTokens(func(tx *TokenTx) error {
+		tx.Put(storage)
+		return nil
+	})
+}
+
+// DeleteTokens removes the tokens saved for c.ServerURL and c.ClientID,
+// reporting whether an entry existed.
+func (c *Client) DeleteTokens() (bool, error) {
+	var removed bool
+	err := c.UpdateTokens(func(tx *TokenTx) error {
+		removed = tx.Delete()
+		return nil
+	})
+	return removed, err
+}
+
+// DiscardAccessToken forgets accessToken after a server rejected it, so that
+// the next FreshToken refreshes it instead of returning it again. The refresh
+// token is kept, and nothing changes when a different access token has been
+// saved since. An agent at c.AgentSocket is asked to replace the token.
+func (c *Client) DiscardAccessToken(ctx context.Context, accessToken string) error {
+	if c.AgentSocket != "" {
+		if _, err := c.agentToken(ctx, 0, accessToken); err == nil {
+			return nil
+		}
+	}
+	return c.UpdateTokens(func(tx *TokenTx) error {
+		saved, ok := tx.Get()
+		if !ok || saved.AccessToken != accessToken {
+			return nil
+		}
+		saved.AccessToken = ""
+		saved.ExpiresAt = time.Now().Add(saved.ClockSkew)
+		tx.Put(saved)
+		return nil
+	})
+}
+
+// TokenTx is a read-modify-write transaction over the saved tokens, passed to
+// the function given to Client.UpdateTokens. No other process can read or
+// change the saved tokens until the transaction ends.
+type TokenTx struct {
+	c       *Client
+	tokens  map[string]*TokenStorage
+	changed bool
+}
+
+// Get returns the tokens saved for c.ServerURL and c.ClientID.
+func (tx *TokenTx) Get() (*TokenStorage, bool) {
+	storage, ok := tx.tokens[tx.c.tokenKey()]
+	return storage, ok
+}
+
+// Put saves storage under its issuer and client ID, which default to the
+// client's own.
+func (tx *TokenTx) Put(storage *TokenStorage) {
+	if storage.ClientID == "" {
+		storage.ClientID = tx.c.ClientID
+	}
+	if storage.Issuer == "" {
+		storage.Issuer = tx.c.issuer()
+	}
+	tx.tokens[TokenKey(storage.Issuer, storage.ClientID)] = storage
+	tx.changed = true
+}
+
+// Delete removes the tokens saved for c.ServerURL and c.ClientID, reporting
+// whether an entry existed.
+func (tx *TokenTx) Delete() bool {
+	if _, ok := tx.tokens[tx.c.tokenKey()]; !ok {
+		return false
+	}
+	delete(tx.tokens, tx.c.tokenKey())
+	tx.changed = true
+	return true
+}
+
+// UpdateTokens runs fn in a transaction holding exclusive access to the saved
+// tokens. fn sees the tokens as they are once access is granted, so a value
+// read before the call may be stale. Changes made through tx are saved when
+// fn returns nil; an error from fn discards them and is returned as is.
+func (c *Client) UpdateTokens(fn func(tx *TokenTx) error) error {
+	return c.updateTokens(context.Background(), fn)
+}
+
+// updateTokens is UpdateTokens, ending a wait for the store's lock when ctx is
+// done.
+func (c *Client) updateTokens(ctx context.Context, fn func(tx *TokenTx) error) error {
+	return c.modifyTokens(ctx, func(tokens map[string]*TokenStorage) (bool, error) {
+		tx := &TokenTx{c: c, tokens: tokens}
+		err := fn(tx)
+		return tx.changed, err
+	})
+}
+
+// store returns c.Store, or a FileStore for c.TokenFile when it is nil.
+func (c *Client) store() TokenStore {
+	if c.Store != nil {
+		return c.Store
+	}
+	return &FileStore{Path: c.TokenFile}
+}
+
+// modifyTokens applies fn to the saved token map with exclusive access and
+// saves the result when fn reports a change. A legacy entry for c is
+// migrated before fn runs. An error from fn aborts the update and is returned
+// as is.
+func (c *Client) modifyTokens(
+	ctx context.Context,
+	fn func(tokens map[string]*TokenStorage) (bool, error),
+) error {
+	update := func(tokens map[string]*TokenStorage) (bool, error) {
+		migrated := c.migrateLegacy(tokens)
+		changed, err := fn(tokens)
+		return changed || migrated, err
+	}
+	if s, ok := c.store().(contextStore); ok {
+		return s.updateContext(ctx, update)
+	}
+	return c.store().Update(update)
+}
+
+// loadStore loads the saved token map, ending a wait for the store's lock
+// when ctx is done.
+func (c *Client) loadStore(ctx context.Context) (map[string]*TokenStorage, error) {
+	if s, ok := c.store().(contextStore); ok {
+		return s.loadContext(ctx)
+	}
+	return c.store().Load()
+}
@@ -0,0 +1,113 @@
+package authgate
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTokenKey(t *testing.T) {
+	got := TokenKey("https://auth.example.com/", "abc")
+	if want := "https://auth.example.com#abc"; got != want {
+		t.Errorf("TokenKey() = %q, want %q", got, want)
+	}
+}
+
+func TestSaveTokens_SeparatesServers(t *testing.T) {
+	staging := newTestClient(t)
+	staging.ServerURL = "https://auth.staging.example.com"
+	production := *staging
+	production.ServerURL = "https://auth.example.com"
+
+	for _, c := range []*Client{staging, &production} {
+		if err := c.SaveTokens(&TokenStorage{
+			AccessToken: "access-" + c.ServerURL,
+			TokenType:   "Bearer",
+			ExpiresAt:   time.Now().Add(time.Hour),
+		}); err != nil {
+			t.Fatalf("SaveTokens(%s) error = %v", c.ServerURL, err)
+		}
+	}
+
+	for _, c := range []*Client{staging, &production} {
+		storage, err := c.LoadTokens()
+		if err != nil {
+			t.Fatalf("LoadTokens(%s) error = %v", c.ServerURL, err)
+		}
+		if storage.AccessToken != "access-"+c.ServerURL {
+			t.Errorf(
+				"LoadTokens(%s) = %q, got another server's token",
+				c.ServerURL, storage.AccessToken,
+			)
+		}
+		if storage.Issuer != c.ServerURL {
+			t.Errorf("Issuer = %q, want %q", storage.Issuer, c.ServerURL)
+		}
+	}
+}
+
+func TestLoadTokens_MigratesLegacyEntry(t *testing.T) {
+	c := newTestClient(t)
+	legacy := `{"tokens": {
+		"test-client": {"access_token": "legacy-access", "refresh_token": "legacy-refresh",
+			"token_type": "Bearer", "expires_at": "2099-01-01T00:00:00Z",
+			"client_id": "test-client"},
+		"other-client": {"access_token": "other-access", "client_id": "other-client"}
+	}}`
+	if err := os.WriteFile(c.TokenFile, []byte(legacy), 0o600); err != nil {
+		t.Fatalf("failed to write token file: %v", err)
+	}
+
+	storage, err := c.LoadTokens()
+	if err != nil {
+		t.Fatalf("LoadTokens() error = %v", err)
+	}
+	if storage.AccessToken != "legacy-access" || storage.Issuer != c.ServerURL {
+		t.Errorf("LoadTokens() = %+v, want migrated legacy entry", storage)
+	}
+
+	data, err := os.ReadFile(c.TokenFile)
+	if err != nil {
+		t.Fatalf("failed to read token file: %v", err)
+	}
+	var storageMap TokenStorageMap
+	if err := json.Unmarshal(data, &storageMap); err != nil {
+		t.Fatalf("failed to parse token file: %v", err)
+	}
+	if _, ok := storageMap.Tokens["test-client"]; ok {
+		t.Error("legacy key still present after migration")
+	}
+	if _, ok := storageMap.Tokens[TokenKey(c.ServerURL, "test-client")]; !ok {
+		t.Error("migrated entry not written under the new key")
+	}
+	if _, ok := storageMap.Tokens["other-client"]; !ok {
+		t.Error("other client's legacy entry was discarded")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	c := newTestClient(t)
+	c.Store = &MemoryStore{}
+
+	if _, err := c.LoadTokens(); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("LoadTokens() on empty store error = %v, want fs.ErrNotExist", err)
+	}
+
+	saveTestTokens(t, c, c.ClientID)
+	storage, err := c.LoadTokens()
+	if err != nil {
+		t.Fatalf("LoadTokens() error = %v", err)
+	}
+
+	// Loaded entries are copies and do not change the store.
+	storage.AccessToken = "modified"
+	if again, _ := c.LoadTokens(); again.AccessToken == "modified" {
+		t.Error("modifying a loaded entry changed the store")
+	}
+	if _, err := os.Stat(c.TokenFile); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("memory store wrote the token file: %v", err)
+	}
+}
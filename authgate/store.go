@@ -0,0 +1,257 @@
+package authgate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// TokenStore persists the token map shared by all clients. Keys are
+// TokenKey values.
+type TokenStore interface {
+	// Load returns the saved token map. It returns an error wrapping
+	// fs.ErrNotExist when nothing has been saved yet.
+	Load() (map[string]*TokenStorage, error)
+	// Update applies fn to the saved token map while holding exclusive
+	// access and saves the result when fn reports a change. An error from fn
+	// aborts the update and is returned as is.
+	Update(fn func(tokens map[string]*TokenStorage) (bool, error)) error
+	// String describes where tokens are kept, for progress messages.
+	String() string
+}
+
+// contextStore is implemented by the stores whose wait for the lock file can
+// be cut short by a context.
+type contextStore interface {
+	loadContext(ctx context.Context) (map[string]*TokenStorage, error)
+	updateContext(
+		ctx context.Context,
+		fn func(tokens map[string]*TokenStorage) (bool, error),
+	) error
+}
+
+// corruptTimeFormat names backups of unparseable token files.
+const corruptTimeFormat = "20060102T150405Z"
+
+// FileStore keeps tokens as JSON in a file readable only by its owner.
+// Access is coordinated across processes with kernel advisory locks on
+// Path+".lock": readers share the lock, updates hold it exclusively.
+type FileStore struct {
+	Path string
+	// LockTimeout bounds the wait for the lock. DefaultLockTimeout is used
+	// when zero.
+	LockTimeout time.Duration
+	// Key seals the file with AES-256-GCM when non-nil. Plaintext files are
+	// still read, and are sealed by the next update.
+	Key *FileKey
+	// DecryptKey opens a sealed file when Key is nil, so that an encrypted
+	// file can be read and rewritten as plaintext by the next update.
+	DecryptKey *FileKey
+}
+
+// Load reads the token file under a shared lock. When the lock file cannot
+// be created, as in a read-only directory, the file is read without it.
+func (s *FileStore) Load() (map[string]*TokenStorage, error) {
+	return s.loadContext(context.Background())
+}
+
+func (s *FileStore) loadContext(ctx context.Context) (map[string]*TokenStorage, error) {
+	if _, err := os.Stat(s.Path); err != nil {
+		return nil, err
+	}
+	lock, err := acquireSharedLock(ctx, s.Path, s.LockTimeout)
+	switch {
+	case err == nil:
+		defer func() {
+			if releaseErr := lock.release(); releaseErr != nil {
+				fmt.Fprintf(os.Stderr, "failed to release lock: %v\n", releaseErr)
+			}
+		}()
+	case !isLockUnavailable(err):
+		return nil, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	data, err = openSealed(s.openKey(), data)
+	if err != nil {
+		return nil, err
+	}
+
+	storageMap, err := decodeTokenFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token file: %w", err)
+	}
+	return storageMap.Tokens, nil
+}
+
+// Update applies fn to the token file while holding the file lock and writes
+// the result back atomically when fn reports a change.
+func (s *FileStore) Update(fn func(tokens map[string]*TokenStorage) (bool, error)) error {
+	return s.updateContext(context.Background(), fn)
+}
+
+func (s *FileStore) updateContext(
+	ctx context.Context,
+	fn func(tokens map[string]*TokenStorage) (bool, error),
+) error {
+	// Acquire file lock to prevent concurrent access
+	lock, err := acquireFileLock(ctx, s.Path, s.LockTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	defer func() {
+		if releaseErr := lock.release(); releaseErr != nil {
+			fmt.Fprintf(os.Stderr, "failed to release lock: %v\n", releaseErr)
+		}
+	}()
+
+	// Load existing token map (inside lock to ensure consistency)
+	storageMap, err := s.readForUpdate()
+	if err != nil {
+		return err
+	}
+
+	changed, err := fn(storageMap.Tokens)
+	if err != nil || !changed {
+		return err
+	}
+
+	// Marshal data
+	data, err := json.MarshalIndent(storageMap, "", "  ")
+	if err != nil {
+		return err
+	}
+	if s.Key != nil {
+		if data, err = s.Key.seal(data); err != nil {
+			return fmt.Errorf("failed to encrypt token file: %w", err)
+		}
+	}
+
+	// Write to temp file first (atomic write pattern)
+	tempFile := s.Path + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	// Atomic rename (replaces old file)
+	if err := os.Rename(tempFile, s.Path); err != nil {
+		if removeErr := os.Remove(tempFile); removeErr != nil {
+			return fmt.Errorf(
+				"failed to rename temp file: %v; additionally failed to remove temp file: %w",
+				err,
+				removeErr,
+			)
+		}
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+
+	return nil
+}
+
+// readForUpdate reads the token file for Update. A missing file yields an
+// empty map. A file that cannot be parsed is moved aside to
+// <path>.corrupt-<timestamp> rather than overwritten, so that the tokens of
+// other clients can still be recovered by hand. A sealed file that cannot be
+// opened is an error and is left untouched.
+func (s *FileStore) readForUpdate() (*TokenStorageMap, error) {
+	empty := &TokenStorageMap{Version: TokenFileVersion, Tokens: make(map[string]*TokenStorage)}
+
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return empty, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token file: %w", err)
+	}
+	if data, err = openSealed(s.openKey(), data); err != nil {
+		return nil, err
+	}
+
+	storageMap, err := decodeTokenFile(data)
+	if err != nil {
+		backup := s.Path + ".corrupt-" + time.Now().UTC().Format(corruptTimeFormat)
+		if renameErr := os.Rename(s.Path, backup); renameErr != nil {
+			return nil, fmt.Errorf(
+				"token file is corrupt (%v) and could not be backed up: %w", err, renameErr,
+			)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: token file is corrupt (%v); moved it to %s\n", err, backup)
+		return empty, nil
+	}
+	if storageMap.Tokens == nil {
+		storageMap.Tokens = make(map[string]*TokenStorage)
+	}
+	return storageMap, nil
+}
+
+// openKey returns the key that opens a sealed token file, or nil.
+func (s *FileStore) openKey() *FileKey {
+	if s.Key != nil {
+		return s.Key
+	}
+	return s.DecryptKey
+}
+
+func (s *FileStore) String() string {
+	if s.Key != nil {
+		return s.Path + " (encrypted)"
+	}
+	return s.Path
+}
+
+// MemoryStore keeps tokens in memory for the life of the process. It is
+// meant for tests and for programs that must not persist tokens. The zero
+// value is ready to use.
+type MemoryStore struct {
+	mu     sync.Mutex
+	tokens map[string]*TokenStorage
+}
+
+// Load returns a copy of the saved token map.
+func (s *MemoryStore) Load() (map[string]*TokenStorage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tokens == nil {
+		return nil, fmt.Errorf("memory store: %w", fs.ErrNotExist)
+	}
+	return cloneTokens(s.tokens), nil
+}
+
+// Update applies fn to a copy of the token map and keeps the copy when fn
+// reports a change.
+func (s *MemoryStore) Update(fn func(tokens map[string]*TokenStorage) (bool, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := cloneTokens(s.tokens)
+	changed, err := fn(tokens)
+	if err != nil || !changed {
+		return err
+	}
+	s.tokens = tokens
+	return nil
+}
+
+func (s *MemoryStore) String() string {
+	return "memory"
+}
+
+// cloneTokens copies the map and its entries so that callers cannot modify
+// the stored tokens in place.
+func cloneTokens(tokens map[string]*TokenStorage) map[string]*TokenStorage {
+	clone := make(map[string]*TokenStorage, len(tokens))
+	for key, storage := range tokens {
+		copied := *storage
+		clone[key] = &copied
+	}
+	return clone
+}
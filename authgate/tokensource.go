@@ -0,0 +1,128 @@
+package authgate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// DefaultRefreshAhead is how long before expiry a token is treated as expired
+// when Client.RefreshAhead is zero, so it is not handed out just before the
+// server rejects it.
+const DefaultRefreshAhead = time.Minute
+
+// refreshAhead returns c.RefreshAhead, or DefaultRefreshAhead when it is zero.
+func (c *Client) refreshAhead() time.Duration {
+	if c.RefreshAhead <= 0 {
+		return DefaultRefreshAhead
+	}
+	return c.RefreshAhead
+}
+
+// FreshToken returns the saved tokens for c.ClientID if they remain valid for
+// longer than skew, or than c.RefreshAhead if that is longer. Otherwise it
+// refreshes them, and if that is not possible it runs a device flow through
+// d. Tokens that lack one of c.Scopes are not refreshed but replaced by a
+// device flow. When d is nil, ErrLoginRequired is
+// returned instead of starting a device flow. When c.AgentSocket is set the
+// agent is asked first, and the store is only read if it has no usable token.
+func (c *Client) FreshToken(
+	ctx context.Context,
+	skew time.Duration,
+	d Displayer,
+) (*TokenStorage, error) {
+	if c.AgentSocket != "" {
+		storage, err := c.agentToken(ctx, skew, "")
+		if err == nil && len(storage.MissingScopes(c.scopes())) == 0 {
+			return storage, nil
+		}
+	}
+
+	storage, err := c.loadTokensWait(ctx)
+	if err == nil {
+		if missing := storage.MissingScopes(c.scopes()); len(missing) > 0 {
+			if d == nil {
+				return nil, fmt.Errorf(
+					"%w: saved token lacks scope %q",
+					ErrLoginRequired,
+					strings.Join(missing, " "),
+				)
+			}
+			return c.PerformDeviceFlow(ctx, d)
+		}
+	}
+	if err == nil && storage.Valid(max(skew, c.refreshAhead())) {
+		return storage, nil
+	}
+
+	if err == nil {
+		storage, err = c.RefreshAccessToken(ctx, storage.RefreshToken, displayerOrNoop(d))
+		if err == nil {
+			return storage, nil
+		}
+	}
+	if !errors.Is(err, ErrNoTokens) &&
+		!errors.Is(err, fs.ErrNotExist) &&
+		!errors.Is(err, ErrRefreshTokenExpired) {
+		return nil, err
+	}
+
+	if d == nil {
+		return nil, ErrLoginRequired
+	}
+	return c.PerformDeviceFlow(ctx, d)
+}
+
+// TokenSource returns an oauth2.TokenSource backed by the token file. Tokens
+// are refreshed c.RefreshAhead before they expire, and a device flow is run through d
+// when no usable token exists; pass a nil d to fail with ErrLoginRequired
+// instead. The returned source is safe for concurrent use.
+func (c *Client) TokenSource(ctx context.Context, d Displayer) oauth2.TokenSource {
+	return &tokenSource{ctx: ctx, client: c, d: d}
+}
+
+// tokenSource implements oauth2.TokenSource on top of Client.FreshToken.
+type tokenSource struct {
+	ctx    context.Context // oauth2.TokenSource.Token takes no context
+	client *Client
+	d      Displayer
+
+	mu sync.Mutex
+}
+
+// Token returns a valid token, refreshing or re-authenticating as needed.
+func (s *tokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	storage, err := s.client.FreshToken(s.ctx, s.client.refreshAhead(), s.d)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Token(), nil
+}
+
+// noopDisplayer discards all progress events.
+type noopDisplayer struct{}
+
+func (noopDisplayer) DeviceCodeReady(_, _, _ string, _ time.Time) {}
+func (noopDisplayer) WaitingForAuth()                             {}
+func (noopDisplayer) PollSlowDown(_ time.Duration)                {}
+func (noopDisplayer) AuthSuccess()                                {}
+func (noopDisplayer) TokenSaved(_ string)                         {}
+func (noopDisplayer) TokenSaveFailed(_ error)                     {}
+func (noopDisplayer) IDTokenRejected(_ error)                     {}
+
+// displayerOrNoop returns d, or a Displayer that discards events when d is nil.
+func displayerOrNoop(d Displayer) Displayer {
+	if d == nil {
+		return noopDisplayer{}
+	}
+	return d
+}
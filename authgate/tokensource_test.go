@@ -0,0 +1,169 @@
+package authgate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenSource_RefreshesExpiredToken(t *testing.T) {
+	var refreshCalls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth/token" {
+			http.NotFound(w, r)
+			return
+		}
+		refreshCalls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "refreshed-access-token",
+			"refresh_token": "refreshed-refresh-token",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	}))
+	defer server.Close()
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	if err := c.SaveTokens(&TokenStorage{
+		AccessToken:  "expired-access-token",
+		RefreshToken: "saved-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+		Scope:        "read write",
+	}); err != nil {
+		t.Fatalf("SaveTokens() error = %v", err)
+	}
+
+	src := c.TokenSource(context.Background(), nil)
+	for range 2 {
+		token, err := src.Token()
+		if err != nil {
+			t.Fatalf("Token() error = %v", err)
+		}
+		if token.AccessToken != "refreshed-access-token" {
+			t.Errorf("AccessToken = %s, want refreshed-access-token", token.AccessToken)
+		}
+		if !token.Valid() {
+			t.Error("Token() returned an invalid token")
+		}
+	}
+
+	// The second call must reuse the refreshed token saved to disk.
+	if got := refreshCalls.Load(); got != 1 {
+		t.Errorf("refresh calls = %d, want 1", got)
+	}
+
+	// The server omitted scope, so the previously granted scope is kept.
+	saved, err := c.LoadTokens()
+	if err != nil {
+		t.Fatalf("LoadTokens() error = %v", err)
+	}
+	if saved.Scope != "read write" {
+		t.Errorf("Scope = %q, want %q", saved.Scope, "read write")
+	}
+}
+
+func TestFreshToken_MissingScopeRequiresLogin(t *testing.T) {
+	c := newTestClient(t)
+	c.Scopes = []string{"read", "admin"}
+	if err := c.SaveTokens(&TokenStorage{
+		AccessToken:  "valid-access-token",
+		RefreshToken: "saved-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(time.Hour),
+		Scope:        "read write",
+	}); err != nil {
+		t.Fatalf("SaveTokens() error = %v", err)
+	}
+
+	_, err := c.FreshToken(context.Background(), DefaultRefreshAhead, nil)
+	if !errors.Is(err, ErrLoginRequired) {
+		t.Errorf("FreshToken() error = %v, want ErrLoginRequired", err)
+	}
+
+	c.Scopes = []string{"read"}
+	storage, err := c.FreshToken(context.Background(), DefaultRefreshAhead, nil)
+	if err != nil {
+		t.Fatalf("FreshToken() with granted scope error = %v", err)
+	}
+	if storage.AccessToken != "valid-access-token" {
+		t.Errorf("AccessToken = %s, want saved token", storage.AccessToken)
+	}
+}
+
+func TestMissingScopes(t *testing.T) {
+	tests := []struct {
+		name      string
+		granted   string
+		requested []string
+		want      []string
+	}{
+		{"all granted", "read write", []string{"write", "read"}, nil},
+		{"narrower request", "read write", []string{"read"}, nil},
+		{"missing scope", "read", []string{"read", "write"}, []string{"write"}},
+		{"unknown grant", "", []string{"admin"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &TokenStorage{Scope: tt.granted}
+			if got := s.MissingScopes(tt.requested); !slices.Equal(got, tt.want) {
+				t.Errorf("MissingScopes(%v) = %v, want %v", tt.requested, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenSource_LoginRequiredWithoutDisplayer(t *testing.T) {
+	c := newTestClient(t)
+
+	_, err := c.TokenSource(context.Background(), nil).Token()
+	if !errors.Is(err, ErrLoginRequired) {
+		t.Errorf("Token() error = %v, want ErrLoginRequired", err)
+	}
+}
+
+func TestFreshToken_RefreshAhead(t *testing.T) {
+	var refreshCalls atomic.Int32
+	server := newRotatingServer(t, &refreshCalls, 0)
+
+	tests := []struct {
+		name         string
+		refreshAhead time.Duration
+		wantRefresh  int32
+	}{
+		{"default window", 0, 1},
+		{"shorter window", 10 * time.Second, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refreshCalls.Store(0)
+			c := newTestClient(t)
+			c.ServerURL = server.URL
+			c.RefreshAhead = tt.refreshAhead
+			if err := c.SaveTokens(&TokenStorage{
+				AccessToken:  "initial-access-token",
+				RefreshToken: "initial-refresh-token",
+				TokenType:    "Bearer",
+				ExpiresAt:    time.Now().Add(30 * time.Second),
+			}); err != nil {
+				t.Fatalf("SaveTokens() error = %v", err)
+			}
+
+			if _, err := c.FreshToken(context.Background(), 0, nil); err != nil {
+				t.Fatalf("FreshToken() error = %v", err)
+			}
+			if got := refreshCalls.Load(); got != tt.wantRefresh {
+				t.Errorf("refresh calls = %d, want %d", got, tt.wantRefresh)
+			}
+		})
+	}
+}
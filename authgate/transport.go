@@ -0,0 +1,162 @@
+package authgate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Transport is an http.RoundTripper that adds the client's bearer token to
+// every request. When the server answers 401, the token is refreshed once
+// under the token file lock and the request is replayed with the new token.
+// Requests with a body are only replayed if GetBody is set, which
+// http.NewRequest does for in-memory bodies.
+//
+// Concurrent requests that hit a 401 with the same token share a single
+// refresh, so a rotating refresh token is only used once.
+type Transport struct {
+	// Client supplies, stores and refreshes the tokens.
+	Client *Client
+	// Base sends the requests. http.DefaultTransport is used when nil.
+	Base http.RoundTripper
+
+	mu    sync.Mutex // guards token and serializes refreshes
+	token *TokenStorage
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	storage, err := t.currentToken(req.Context())
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	resp, err := t.base().RoundTrip(withBearer(req, req.Body, storage.AccessToken))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// The original body has been consumed; without GetBody the request
+	// cannot be replayed, so hand the 401 back to the caller.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	storage, err = t.refresh(req.Context(), storage.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	body := req.Body
+	if req.GetBody != nil {
+		if body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return t.base().RoundTrip(withBearer(req, body, storage.AccessToken))
+}
+
+// base returns the underlying RoundTripper.
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// currentToken returns the cached token, reloading it through FreshToken when
+// it is missing or about to expire.
+func (t *Transport) currentToken(ctx context.Context) (*TokenStorage, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ahead := t.Client.refreshAhead()
+	if t.token != nil && t.token.Valid(ahead) {
+		return t.token, nil
+	}
+	storage, err := t.Client.FreshToken(ctx, ahead, nil)
+	if err != nil {
+		return nil, err
+	}
+	t.token = storage
+	return storage, nil
+}
+
+// refresh replaces the token the server rejected. If another goroutine has
+// already replaced it, its result is reused instead of refreshing again. An
+// agent at Client.AgentSocket is asked for the replacement first.
+func (t *Transport) refresh(ctx context.Context, rejected string) (*TokenStorage, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != nil && t.token.AccessToken != rejected {
+		return t.token, nil
+	}
+	storage, err := t.Client.RefreshRejected(ctx, rejected)
+	if err != nil {
+		return nil, err
+	}
+	t.token = storage
+	return storage, nil
+}
+
+// RefreshRejected returns tokens to replace the access token rejected by a
+// resource server. An agent at c.AgentSocket is asked first, as the tokens it
+// serves carry no refresh token; otherwise the saved tokens are refreshed,
+// unless another process already replaced rejected.
+func (c *Client) RefreshRejected(ctx context.Context, rejected string) (*TokenStorage, error) {
+	if c.AgentSocket != "" {
+		if storage, err := c.agentToken(ctx, 0, rejected); err == nil {
+			return storage, nil
+		}
+	}
+	return c.refreshIfUnchanged(ctx, rejected)
+}
+
+// refreshIfUnchanged refreshes the saved tokens while holding the token file
+// lock. If the saved access token no longer matches rejected, another process
+// has already refreshed it and the saved tokens are returned unchanged.
+func (c *Client) refreshIfUnchanged(ctx context.Context, rejected string) (*TokenStorage, error) {
+	var storage *TokenStorage
+	err := c.updateTokensWait(ctx, func(tx *TokenTx) error {
+		saved, ok := tx.Get()
+		if !ok {
+			return ErrNoTokens
+		}
+		if saved.AccessToken != rejected {
+			storage = saved
+			return nil
+		}
+
+		refreshed, err := c.requestRefresh(ctx, saved.RefreshToken, saved, noopDisplayer{})
+		if err != nil {
+			return err
+		}
+		tx.Put(refreshed)
+		storage = refreshed
+		return nil
+	})
+	if errors.Is(err, ErrNoTokens) {
+		return nil, ErrLoginRequired
+	}
+	return storage, err
+}
+
+// withBearer returns a copy of req carrying body and the bearer token.
+func withBearer(req *http.Request, body io.ReadCloser, accessToken string) *http.Request {
+	out := req.Clone(req.Context())
+	out.Body = body
+	out.Header.Set("Authorization", "Bearer "+accessToken)
+	return out
+}
+
+// closeRequestBody closes req.Body as RoundTrip must, even on error.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
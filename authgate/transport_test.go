@@ -0,0 +1,177 @@
+package authgate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newRotatingServer returns a server whose /api endpoint only accepts the
+// latest access token and whose /oauth/token endpoint rotates both tokens.
+// Reusing an already-rotated refresh token fails with invalid_grant. Token
+// requests are answered after delay.
+func newRotatingServer(
+	t *testing.T,
+	refreshCalls *atomic.Int32,
+	delay time.Duration,
+) *httptest.Server {
+	t.Helper()
+
+	var mu sync.Mutex
+	current := "initial-access-token"
+	refresh := "initial-refresh-token"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.URL.Path {
+		case "/oauth/token":
+			time.Sleep(delay)
+			refreshCalls.Add(1)
+			if err := r.ParseForm(); err != nil || r.FormValue("refresh_token") != refresh {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid_grant"})
+				return
+			}
+			n := refreshCalls.Load()
+			current = fmt.Sprintf("rotated-access-token-%d", n)
+			refresh = fmt.Sprintf("rotated-refresh-token-%d", n)
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"access_token":  current,
+				"refresh_token": refresh,
+				"token_type":    "Bearer",
+				"expires_in":    3600,
+			})
+		case "/api":
+			if r.Header.Get("Authorization") != "Bearer "+current {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			_, _ = w.Write(body)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTransport_RefreshesOnceAndReplaysBody(t *testing.T) {
+	var refreshCalls atomic.Int32
+	server := newRotatingServer(t, &refreshCalls, 0)
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	if err := c.SaveTokens(&TokenStorage{
+		AccessToken:  "revoked-access-token",
+		RefreshToken: "initial-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("SaveTokens() error = %v", err)
+	}
+
+	httpClient := &http.Client{Transport: &Transport{Client: c}}
+
+	const requests = 10
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Go(func() {
+			payload := []byte{'a' + byte(i)}
+			req, err := http.NewRequestWithContext(
+				context.Background(), http.MethodPost, server.URL+"/api", bytes.NewReader(payload),
+			)
+			if err != nil {
+				t.Errorf("NewRequest() error = %v", err)
+				return
+			}
+			resp, err := httpClient.Do(req)
+			if err != nil {
+				t.Errorf("request %d: %v", i, err)
+				return
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("request %d: status = %d, want 200", i, resp.StatusCode)
+			}
+			if !bytes.Equal(body, payload) {
+				t.Errorf("request %d: replayed body = %q, want %q", i, body, payload)
+			}
+		})
+	}
+	wg.Wait()
+
+	if got := refreshCalls.Load(); got != 1 {
+		t.Errorf("refresh calls = %d, want 1", got)
+	}
+
+	saved, err := c.LoadTokens()
+	if err != nil {
+		t.Fatalf("LoadTokens() error = %v", err)
+	}
+	if saved.RefreshToken != "rotated-refresh-token-1" {
+		t.Errorf("saved RefreshToken = %s, want rotated-refresh-token-1", saved.RefreshToken)
+	}
+}
+
+func TestTransport_ReusesTokenRefreshedByAnotherProcess(t *testing.T) {
+	var refreshCalls atomic.Int32
+	server := newRotatingServer(t, &refreshCalls, 0)
+
+	c := newTestClient(t)
+	c.ServerURL = server.URL
+	if err := c.SaveTokens(&TokenStorage{
+		AccessToken:  "revoked-access-token",
+		RefreshToken: "initial-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("SaveTokens() error = %v", err)
+	}
+
+	transport := &Transport{Client: c}
+	if _, err := transport.currentToken(context.Background()); err != nil {
+		t.Fatalf("currentToken() error = %v", err)
+	}
+
+	// Another process refreshes and saves while this transport still holds
+	// the old token in memory.
+	other := *c
+	if _, err := other.RefreshAccessToken(
+		context.Background(), "initial-refresh-token", noopDisplayer{},
+	); err != nil {
+		t.Fatalf("RefreshAccessToken() error = %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(
+		context.Background(), http.MethodGet, server.URL+"/api", nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if got := refreshCalls.Load(); got != 1 {
+		t.Errorf("refresh calls = %d, want 1 (token from disk should be reused)", got)
+	}
+}
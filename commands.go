@@ -0,0 +1,433 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/go-authgate/device-cli/authgate"
+	"github.com/go-authgate/device-cli/tui"
+)
+
+// Exit codes returned by subcommands so shell scripts can tell failure modes apart.
+const (
+	exitOK            = 0
+	exitError         = 1 // unclassified failure
+	exitUsage         = 2 // invalid command line
+	exitNeedsLogin    = 3 // no usable tokens, run "login"
+	exitNetworkError  = 4 // server unreachable or request failed in transit
+	exitTokenExpired  = 5 // access token expired (status only)
+	exitInteractive   = 6 // device flow needed but no terminal is attached
+	exitTokenInactive = 7 // introspection reports the token is not active
+)
+
+// errInteractionRequired is returned when a device flow is needed but the
+// process is not attached to a terminal.
+var errInteractionRequired = errors.New(
+	"interactive login required but stdin/stderr is not a terminal; run login first",
+)
+
+// command is a named subcommand of the CLI.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) int
+}
+
+// commands lists the available subcommands in the order shown by usage.
+var commands = []command{
+	{"login", "Run the device authorization flow and save new tokens", cmdLogin},
+	{"logout", "Revoke and delete the saved tokens for the current client", cmdLogout},
+	{"status", "Show saved token status without contacting the server", cmdStatus},
+	{"token", "Print a valid access token to stdout", cmdToken},
+	{"refresh", "Force a refresh of the saved access token", cmdRefresh},
+	{"exec", "Run a command with the access token in its environment", cmdExec},
+	{"request", "Send an authenticated HTTP request and print the response", cmdRequest},
+	{"introspect", "Ask the server whether the saved token is active", cmdIntrospect},
+	{"whoami", "Verify the saved ID token and print its claims", cmdWhoami},
+	{"decode", "Print the header and claims of a JWT access token", cmdDecode},
+	{"git-credential", "Git credential helper (get | store | erase)", cmdGitCredential},
+	{
+		"docker-credential",
+		"Docker credential helper (get | store | erase | list)",
+		cmdDockerCredential,
+	},
+	{"kube-credential", "Print a Kubernetes ExecCredential for kubectl", cmdKubeCredential},
+	{"agent", "Keep tokens in memory and serve them over a Unix socket", cmdAgent},
+	{"profiles", "List config file profiles or show one (list | show [name])", cmdProfiles},
+	{"migrate-store", "Move all saved tokens to another token store (-to=...)", cmdMigrateStore},
+}
+
+// needsClientID reports whether the command in args needs a client ID.
+// Help, profile inspection and store migration work before any client is
+// configured, and docker-credential picks the client per registry.
+func needsClientID(args []string) bool {
+	if len(args) == 0 {
+		return true
+	}
+	return !slices.Contains(
+		[]string{"help", "profiles", "migrate-store", "docker-credential"},
+		args[0],
+	)
+}
+
+// usage prints the top-level help text including the list of subcommands.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [command]\n\n", os.Args[0])
+	fmt.Fprintln(
+		out,
+		"Without a command, runs the full demo flow (load, refresh, device flow, verify).",
+	)
+	fmt.Fprintln(out, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-17s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+	fmt.Fprintln(out, "\nExit codes:")
+	fmt.Fprintln(out, "  0  success")
+	fmt.Fprintln(out, "  1  unclassified error")
+	fmt.Fprintln(out, "  2  invalid command line")
+	fmt.Fprintln(out, "  3  not logged in or refresh token expired (run login)")
+	fmt.Fprintln(out, "  4  network error")
+	fmt.Fprintln(out, "  5  access token expired (status only)")
+	fmt.Fprintln(out, "  6  login required but no terminal is attached")
+	fmt.Fprintln(out, "  7  token is not active (introspect only)")
+}
+
+// runCommand dispatches args to a subcommand and returns the process exit code.
+// With no arguments it runs the original demo flow.
+func runCommand(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if len(args) == 0 {
+		err := withDisplayer(func(d tui.Displayer) error {
+			d.Banner()
+			return run(d)
+		})
+		if err != nil {
+			return exitCodeFor(err)
+		}
+		return exitOK
+	}
+
+	name := args[0]
+	if name == "help" {
+		usage()
+		return exitOK
+	}
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(ctx, args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: unknown command %q\n\n", name)
+	usage()
+	return exitUsage
+}
+
+// exitCodeFor maps an error to the exit code scripts should see.
+func exitCodeFor(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if errors.Is(err, errInteractionRequired) {
+		return exitInteractive
+	}
+	if isNotLoggedIn(err) ||
+		errors.Is(err, ErrRefreshTokenExpired) ||
+		errors.Is(err, authgate.ErrLoginRequired) {
+		return exitNeedsLogin
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return exitNetworkError
+	}
+	return exitError
+}
+
+// isNotLoggedIn reports whether err means there are no saved tokens for the client.
+func isNotLoggedIn(err error) bool {
+	return errors.Is(err, ErrNoTokens) || errors.Is(err, fs.ErrNotExist)
+}
+
+// noArgs reports a usage error when a subcommand that takes no arguments got some.
+func noArgs(name string, args []string) bool {
+	if len(args) == 0 {
+		return true
+	}
+	fmt.Fprintf(os.Stderr, "Error: %s takes no arguments\n", name)
+	return false
+}
+
+// withDisplayer runs fn with a TUI displayer on stderr when it is a terminal,
+// and a plain-text displayer otherwise.
+func withDisplayer(fn func(d tui.Displayer) error) error {
+	if !isTTY() {
+		return fn(tui.NewPlainDisplayer(os.Stderr))
+	}
+
+	// Run TUI program on stderr so stdout pipes are not corrupted
+	m := tui.NewModel()
+	// WithInput(nil): disable stdin/keyboard input so BubbleTea skips terminal
+	// capability queries (?2026/?2027). Ctrl+C is handled by signal.NotifyContext.
+	p := tea.NewProgram(m, tea.WithOutput(os.Stderr), tea.WithInput(nil))
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		if _, err := p.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "TUI error: %v\n", err)
+		}
+	})
+
+	err := fn(tui.NewProgramDisplayer(p))
+	p.Quit() // let BubbleTea drain terminal query responses before exiting
+	wg.Wait()
+	return err
+}
+
+// showDone reports the final token summary through d.
+func showDone(d tui.Displayer, storage *TokenStorage) {
+	tokenPreview := storage.AccessToken
+	if len(tokenPreview) > 50 {
+		tokenPreview = tokenPreview[:50]
+	}
+	d.Done(tokenPreview, storage.TokenType, time.Until(storage.Expiry()).Round(time.Second))
+}
+
+// cmdLogin always runs a fresh device flow, ignoring any saved tokens.
+func cmdLogin(ctx context.Context, args []string) int {
+	if !noArgs("login", args) {
+		return exitUsage
+	}
+
+	err := withDisplayer(func(d tui.Displayer) error {
+		d.Banner()
+		storage, err := performDeviceFlow(ctx, d)
+		if err != nil {
+			d.Fatal(err)
+			return err
+		}
+		showDone(d, storage)
+		return nil
+	})
+	return exitCodeFor(err)
+}
+
+// cmdLogout revokes the current client's tokens on the server and then
+// removes its entry from the token file. With -all, every client in the file
+// is revoked and removed.
+func cmdLogout(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("logout", flag.ContinueOnError)
+	all := flags.Bool(
+		"all",
+		false,
+		"Revoke and remove the tokens of every client in the token file",
+	)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if !noArgs("logout", flags.Args()) {
+		return exitUsage
+	}
+
+	if *all {
+		removed, err := newClient().LogoutAll(ctx)
+		removed, agentErr := agentLogoutAll(ctx, removed)
+		err = errors.Join(err, agentErr)
+		for _, s := range removed {
+			fmt.Fprintf(os.Stderr, "Logged out client_id: %s (%s)\n", s.ClientID, s.Issuer)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Tokens that could not be revoked were kept; run logout again.")
+			return exitCodeFor(err)
+		}
+		if len(removed) == 0 {
+			fmt.Fprintln(os.Stderr, "No saved tokens")
+		}
+		return exitOK
+	}
+
+	removedAgent, err := newClient().AgentLogout(ctx)
+	if err != nil && !errors.Is(err, authgate.ErrAgentUnavailable) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprintln(os.Stderr, "Tokens were not revoked and have been kept; run logout again.")
+		return exitCodeFor(err)
+	}
+	removed, err := newClient().Logout(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprintln(os.Stderr, "Tokens were not revoked and have been kept; run logout again.")
+		return exitCodeFor(err)
+	}
+	if !removed && !removedAgent {
+		fmt.Fprintf(os.Stderr, "No saved tokens for client_id: %s\n", clientID)
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "Logged out client_id: %s\n", clientID)
+	return exitOK
+}
+
+// cmdStatus reports the saved token's expiry without contacting the server.
+// An agent's entry for the client is reported in preference to the store.
+func cmdStatus(ctx context.Context, args []string) int {
+	if !noArgs("status", args) {
+		return exitUsage
+	}
+
+	// The agent is asked first, so that an encrypted store does not prompt
+	// for its passphrase when the agent holds the tokens.
+	var (
+		store, refresh string
+		storage        *TokenStorage
+		err            error
+	)
+	if entry := agentEntry(ctx); entry != nil {
+		storage = entry
+		store = "agent at " + agentSocket
+		refresh = "held by agent"
+	} else {
+		storage, err = loadTokens()
+		store = newTokenStore().String()
+		refresh = "absent"
+	}
+	if err != nil {
+		if isNotLoggedIn(err) {
+			fmt.Printf("Not logged in (client_id: %s)\n", clientID)
+			return exitNeedsLogin
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	expiry := storage.Expiry()
+	remaining := time.Until(expiry).Round(time.Second)
+	if storage.RefreshToken != "" {
+		refresh = "present"
+	}
+
+	fmt.Printf("Client ID:     %s\n", storage.ClientID)
+	fmt.Printf("Server URL:    %s\n", serverURL)
+	fmt.Printf("Token Store:   %s\n", store)
+	fmt.Printf("Token Type:    %s\n", storage.TokenType)
+	fmt.Printf("Expires At:    %s\n", expiry.Local().Format(time.RFC3339))
+	fmt.Printf("Refresh Token: %s\n", refresh)
+	if storage.Scope != "" {
+		fmt.Printf("Scope:         %s\n", storage.Scope)
+	}
+	if skew := storage.ClockSkew; skew > 0 {
+		fmt.Printf("Clock Skew:    server clock is %s ahead\n", skew)
+	} else if skew < 0 {
+		fmt.Printf("Clock Skew:    server clock is %s behind\n", -skew)
+	}
+
+	switch {
+	case remaining <= 0:
+		fmt.Printf("Status:        expired %s ago\n", -remaining)
+		return exitTokenExpired
+	case !storage.Valid(refreshAhead):
+		fmt.Printf("Status:        valid for %s, refreshed before next use\n", remaining)
+	default:
+		fmt.Printf("Status:        valid for %s\n", remaining)
+	}
+	return exitOK
+}
+
+// cmdToken prints a valid access token to stdout for use in scripts, e.g.
+// curl -H "Authorization: Bearer $(device-cli token)". The token is refreshed
+// first if it expires within the skew window, and a device flow is started on
+// stderr when no usable token exists. Nothing but the token is written to stdout.
+func cmdToken(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("token", flag.ContinueOnError)
+	skew := flags.Duration(
+		"skew",
+		refreshAhead,
+		"Refresh the token if it expires within this window (at least -refresh-ahead)",
+	)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if !noArgs("token", flags.Args()) {
+		return exitUsage
+	}
+
+	storage, err := freshToken(ctx, *skew)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCodeFor(err)
+	}
+
+	fmt.Println(storage.AccessToken)
+	return exitOK
+}
+
+// freshToken returns saved tokens that remain valid for at least skew and the
+// refresh-ahead window, refreshing or re-authenticating as needed. All
+// progress output goes to stderr.
+func freshToken(ctx context.Context, skew time.Duration) (*TokenStorage, error) {
+	return obtainToken(ctx, skew, isInteractive())
+}
+
+// obtainToken is freshToken for callers that decide themselves whether a
+// user is present to complete a device flow. When canPrompt is false and a
+// device flow is needed, errInteractionRequired is returned.
+func obtainToken(ctx context.Context, skew time.Duration, canPrompt bool) (*TokenStorage, error) {
+	storage, err := newClient().FreshToken(ctx, skew, nil)
+	if !errors.Is(err, authgate.ErrLoginRequired) {
+		return storage, err
+	}
+
+	if !canPrompt {
+		return nil, errInteractionRequired
+	}
+	err = withDisplayer(func(d tui.Displayer) error {
+		storage, err = performDeviceFlow(ctx, d)
+		if err != nil {
+			d.Fatal(err)
+			return err
+		}
+		showDone(d, storage)
+		return nil
+	})
+	return storage, err
+}
+
+// cmdRefresh refreshes the access token even if it has not expired yet.
+func cmdRefresh(ctx context.Context, args []string) int {
+	if !noArgs("refresh", args) {
+		return exitUsage
+	}
+
+	storage, err := loadTokens()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCodeFor(err)
+	}
+
+	err = withDisplayer(func(d tui.Displayer) error {
+		d.Refreshing()
+		newStorage, err := refreshAccessToken(ctx, storage.RefreshToken, d)
+		if err != nil {
+			d.Fatal(err)
+			return err
+		}
+		d.RefreshOK()
+		showDone(d, newStorage)
+		return nil
+	})
+	return exitCodeFor(err)
+}
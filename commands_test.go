@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExitCodeFor(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, exitOK},
+		{"no tokens", fmt.Errorf("%w for client_id: x", ErrNoTokens), exitNeedsLogin},
+		{"missing token file", &os.PathError{Op: "open", Err: os.ErrNotExist}, exitNeedsLogin},
+		{"refresh token expired", ErrRefreshTokenExpired, exitNeedsLogin},
+		{
+			"network error",
+			fmt.Errorf("refresh request failed: %w", &url.Error{
+				Op:  "Post",
+				URL: "http://localhost:8080/oauth/token",
+				Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")},
+			}),
+			exitNetworkError,
+		},
+		{"interaction required", errInteractionRequired, exitInteractive},
+		{"other", errors.New("boom"), exitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCodeFor(tt.err); got != tt.want {
+				t.Errorf("exitCodeFor(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunCommand_UnknownCommand(t *testing.T) {
+	if got := runCommand([]string{"bogus"}); got != exitUsage {
+		t.Errorf("runCommand(bogus) = %d, want %d", got, exitUsage)
+	}
+}
+
+func TestCmdStatus_NotLoggedIn(t *testing.T) {
+	origTokenFile := tokenFile
+	defer func() { tokenFile = origTokenFile }()
+
+	tokenFile = t.TempDir() + "/missing.json"
+
+	if got := cmdStatus(context.Background(), nil); got != exitNeedsLogin {
+		t.Errorf("cmdStatus() = %d, want %d", got, exitNeedsLogin)
+	}
+}
+
+func TestFreshToken(t *testing.T) {
+	origServerURL := serverURL
+	origClientID := clientID
+	origTokenFile := tokenFile
+	defer func() {
+		serverURL = origServerURL
+		clientID = origClientID
+		tokenFile = origTokenFile
+	}()
+
+	var refreshCalls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		refreshCalls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "refreshed-access-token",
+			"refresh_token": "refreshed-refresh-token",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	}))
+	defer server.Close()
+
+	serverURL = server.URL
+	clientID = "test-client-fresh"
+
+	tests := []struct {
+		name        string
+		expiresIn   time.Duration
+		saved       bool
+		wantToken   string
+		wantErr     error
+		wantRefresh int32
+	}{
+		{"valid beyond skew", time.Hour, true, "saved-access-token", nil, 0},
+		{"expires within skew", 10 * time.Second, true, "refreshed-access-token", nil, 1},
+		{"not logged in and not interactive", 0, false, "", errInteractionRequired, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenFile = filepath.Join(t.TempDir(), "tokens.json")
+			refreshCalls.Store(0)
+
+			if tt.saved {
+				if err := saveTokens(&TokenStorage{
+					AccessToken:  "saved-access-token",
+					RefreshToken: "saved-refresh-token",
+					TokenType:    "Bearer",
+					ExpiresAt:    time.Now().Add(tt.expiresIn),
+					ClientID:     clientID,
+				}); err != nil {
+					t.Fatalf("saveTokens() error = %v", err)
+				}
+			}
+
+			storage, err := freshToken(context.Background(), refreshAhead)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("freshToken() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("freshToken() error = %v", err)
+			}
+			if storage.AccessToken != tt.wantToken {
+				t.Errorf("AccessToken = %s, want %s", storage.AccessToken, tt.wantToken)
+			}
+			if got := refreshCalls.Load(); got != tt.wantRefresh {
+				t.Errorf("refresh calls = %d, want %d", got, tt.wantRefresh)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-authgate/device-cli/authgate"
+)
+
+// cmdDecode prints the header and claims of a JWT: the token given as an
+// argument, or the saved access token, or with -id-token the saved ID token.
+// Decoding is local and works offline; with -verify the signature is also
+// checked against the server's JWKS. Claims are shown as they are, without
+// checking them.
+func cmdDecode(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("decode", flag.ContinueOnError)
+	verify := flags.Bool("verify", false, "Check the signature against the server's JWKS")
+	idToken := flags.Bool(
+		"id-token",
+		false,
+		"Decode the saved ID token instead of the access token",
+	)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "Error: decode takes at most one token")
+		return exitUsage
+	}
+
+	raw := flags.Arg(0)
+	var saved *TokenStorage
+	if raw == "" {
+		var err error
+		saved, err = loadTokens()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitCodeFor(err)
+		}
+		raw = saved.AccessToken
+		if *idToken {
+			raw = saved.IDToken
+		}
+		if raw == "" {
+			fmt.Fprintf(os.Stderr, "Error: no token to decode for client_id %s\n", clientID)
+			return exitNeedsLogin
+		}
+	}
+
+	t, err := authgate.ParseJWT(raw)
+	if err != nil {
+		if errors.Is(err, authgate.ErrNotJWT) && flags.NArg() == 0 && !*idToken {
+			err = fmt.Errorf("the saved access token is %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	for _, part := range []struct {
+		name  string
+		value map[string]any
+	}{{"Header", t.Header}, {"Claims", t.Claims}} {
+		data, err := json.MarshalIndent(part.value, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		fmt.Printf("%s:\n%s\n", part.name, data)
+	}
+
+	if exp, ok := t.Expiry(); ok {
+		// exp is on the server's clock; a saved token's is shown on the local
+		// clock, corrected by the skew measured when it was obtained
+		switch {
+		case saved != nil && !*idToken:
+			exp = saved.Expiry()
+		case saved != nil:
+			exp = exp.Add(-saved.ClockSkew)
+		}
+		if remaining := time.Until(exp).Round(time.Second); remaining > 0 {
+			fmt.Printf("Expires:   %s (in %s)\n", exp.Local().Format(time.RFC3339), remaining)
+		} else {
+			fmt.Printf("Expired:   %s (%s ago)\n", exp.Local().Format(time.RFC3339), -remaining)
+		}
+	}
+
+	if !*verify {
+		fmt.Println("Signature: not verified")
+		return exitOK
+	}
+	if err := newClient().VerifyJWT(ctx, t); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: signature: %v\n", err)
+		return exitCodeFor(err)
+	}
+	fmt.Println("Signature: verified")
+	return exitOK
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCmdDecode(t *testing.T) {
+	origServerURL, origClientID, origTokenFile := serverURL, clientID, tokenFile
+	defer func() {
+		serverURL = origServerURL
+		clientID = origClientID
+		tokenFile = origTokenFile
+	}()
+	tokenFile = filepath.Join(t.TempDir(), "tokens.json")
+	clientID = "test-client-decode"
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/jwks.json" {
+			http.NotFound(w, r)
+			return
+		}
+		b64 := base64.RawURLEncoding.EncodeToString
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "key-1",
+			"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer server.Close()
+	serverURL = server.URL
+
+	exp := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	accessToken := signIDToken(t, key, "key-1", map[string]any{
+		"sub":   "user-1",
+		"aud":   "api",
+		"scope": "read write",
+		"exp":   exp.Unix(),
+	})
+	if err := saveTokens(&TokenStorage{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("saveTokens() error = %v", err)
+	}
+
+	var code int
+	out := withStdio(t, "", func() {
+		code = cmdDecode(context.Background(), nil)
+	})
+	wantExpiry := "Expires:   " + exp.Local().Format(time.RFC3339)
+	for _, want := range []string{`"kid": "key-1"`, `"scope": "read write"`, wantExpiry,
+		"Signature: not verified"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("decode output lacks %q:\n%s", want, out)
+		}
+	}
+	if code != exitOK {
+		t.Errorf("decode exited %d", code)
+	}
+
+	// A saved token's expiry is shown on the local clock.
+	if err := saveTokens(&TokenStorage{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresAt:   time.Now().Add(time.Hour),
+		ClockSkew:   5 * time.Minute,
+	}); err != nil {
+		t.Fatalf("saveTokens() error = %v", err)
+	}
+	out = withStdio(t, "", func() {
+		code = cmdDecode(context.Background(), nil)
+	})
+	wantExpiry = "Expires:   " + exp.Add(-5*time.Minute).Local().Format(time.RFC3339)
+	if code != exitOK || !strings.Contains(out, wantExpiry) {
+		t.Errorf("decode with clock skew = %d, want %q in:\n%s", code, wantExpiry, out)
+	}
+
+	out = withStdio(t, "", func() {
+		code = cmdDecode(context.Background(), []string{"-verify"})
+	})
+	if code != exitOK || !strings.Contains(out, "Signature: verified") {
+		t.Errorf("decode -verify = %d, %q", code, out)
+	}
+
+	parts := strings.Split(accessToken, ".")
+	forged := parts[0] + "." + base64.RawURLEncoding.EncodeToString(
+		[]byte(`{"sub":"admin"}`),
+	) + "." + parts[2]
+	out = withStdio(t, "", func() {
+		code = cmdDecode(context.Background(), []string{"-verify", forged})
+	})
+	if code != exitError || !strings.Contains(out, `"sub": "admin"`) ||
+		strings.Contains(out, "Signature: verified") {
+		t.Errorf("decode -verify of a forged token = %d, %q", code, out)
+	}
+
+	out = withStdio(t, "", func() {
+		code = cmdDecode(context.Background(), []string{"opaque-token"})
+	})
+	if code != exitError || out != "" {
+		t.Errorf("decode of an opaque token = %d, %q; want %d", code, out, exitError)
+	}
+
+	withStdio(t, "", func() {
+		code = cmdDecode(context.Background(), []string{"-id-token"})
+	})
+	if code != exitNeedsLogin {
+		t.Errorf("decode -id-token without an ID token exited %d, want %d", code, exitNeedsLogin)
+	}
+}
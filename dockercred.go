@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-authgate/device-cli/authgate"
+)
+
+// dockerHelperName is the executable name docker looks for when a config
+// names the "authgate" credential helper. A link with this name runs the
+// docker-credential command directly.
+const dockerHelperName = "docker-credential-authgate"
+
+// defaultDockerUsername is returned to docker with the access token as
+// secret. Registries that accept bearer tokens ignore the username.
+const defaultDockerUsername = "oauth2"
+
+// errDockerCredentialsNotFound is the message docker recognizes as "no
+// credentials for this registry", after which it continues anonymously.
+var errDockerCredentialsNotFound = errors.New("credentials not found in native keychain")
+
+// dockerCredentials is the JSON object exchanged with docker by get and store.
+type dockerCredentials struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// commandArgs returns the command line after the global flags. When the
+// binary runs as docker-credential-authgate, the docker-credential command is
+// implied.
+func commandArgs() []string {
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	if name == dockerHelperName {
+		return append([]string{"docker-credential"}, flag.Args()...)
+	}
+	return flag.Args()
+}
+
+// cmdDockerCredential implements the docker credential helper protocol. The
+// registry named in a request selects the client through the [registries]
+// table of the config file; registries it does not list use the active
+// configuration. get never starts a device flow, so it is safe on CI runners:
+// without a usable token it fails and the runner must log in beforehand.
+// erase revokes and removes the registry's tokens, as logout does, and store
+// is a no-op as tokens are saved when they are obtained.
+func cmdDockerCredential(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("docker-credential", flag.ContinueOnError)
+	username := flags.String(
+		"username",
+		defaultDockerUsername,
+		"Username to pair with the access token",
+	)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(
+			os.Stderr,
+			"Error: docker-credential takes one operation: get, store, erase or list",
+		)
+		return exitUsage
+	}
+
+	// Docker reads errors from stdout and shows them verbatim, so they carry
+	// no "Error:" prefix.
+	cfg, err := loadConfigFile(configFilePath())
+	if err != nil {
+		fmt.Println(err)
+		return exitError
+	}
+
+	var out any
+	switch flags.Arg(0) {
+	case "get":
+		out, err = dockerGet(ctx, cfg, os.Stdin, *username)
+	case "erase":
+		err = dockerErase(ctx, cfg, os.Stdin)
+	case "store":
+		_, err = io.Copy(io.Discard, os.Stdin)
+	case "list":
+		out = dockerList(cfg, *username)
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown docker-credential operation %q\n", flags.Arg(0))
+		return exitUsage
+	}
+	if err != nil {
+		fmt.Println(err)
+		return exitCodeFor(err)
+	}
+	if out != nil {
+		if err := json.NewEncoder(os.Stdout).Encode(out); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+	return exitOK
+}
+
+// dockerGet returns the credentials for the registry read from r.
+func dockerGet(
+	ctx context.Context,
+	cfg *configFile,
+	r io.Reader,
+	username string,
+) (*dockerCredentials, error) {
+	registry, err := readDockerServerURL(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := useRegistry(cfg, registry); err != nil {
+		return nil, err
+	}
+	storage, err := obtainToken(ctx, refreshAhead, false)
+	if err != nil {
+		return nil, err
+	}
+	return &dockerCredentials{
+		ServerURL: registry,
+		Username:  username,
+		Secret:    storage.AccessToken,
+	}, nil
+}
+
+// dockerErase revokes and removes the tokens of the registry read from r, in
+// the agent and in the token store, as logout does.
+func dockerErase(ctx context.Context, cfg *configFile, r io.Reader) error {
+	registry, err := readDockerServerURL(r)
+	if err != nil {
+		return err
+	}
+	if err := useRegistry(cfg, registry); err != nil {
+		return err
+	}
+	client := newClient()
+	if _, err := client.AgentLogout(ctx); err != nil &&
+		!errors.Is(err, authgate.ErrAgentUnavailable) {
+		return err
+	}
+	_, err = client.Logout(ctx)
+	return err
+}
+
+// dockerList maps every registry in the config file to username.
+func dockerList(cfg *configFile, username string) map[string]string {
+	list := make(map[string]string, len(cfg.Registries))
+	for registry := range cfg.Registries {
+		list[registry] = username
+	}
+	return list
+}
+
+// readDockerServerURL reads the registry docker sends on stdin.
+func readDockerServerURL(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read registry: %w", err)
+	}
+	registry := strings.TrimSpace(string(data))
+	if registry == "" {
+		return "", errors.New("no registry server URL given")
+	}
+	return registry, nil
+}
+
+// registryHost reduces a registry server URL such as
+// https://registry.example.com/v1/ to its lowercase host and port.
+func registryHost(serverURL string) string {
+	host := serverURL
+	if _, rest, ok := strings.Cut(host, "://"); ok {
+		host = rest
+	}
+	host, _, _ = strings.Cut(host, "/")
+	return strings.ToLower(host)
+}
+
+// useRegistry configures the client for registry. The [registries] table maps
+// a registry host to a profile, applied over the current configuration, or
+// to a client ID. Registries that are not listed use the current
+// configuration; errDockerCredentialsNotFound is returned if that has no
+// client ID.
+func useRegistry(cfg *configFile, registry string) error {
+	if target, ok := cfg.registryTarget(registryHost(registry)); ok {
+		if p, isProfile := cfg.Profiles[target]; isProfile {
+			if err := applyProfile(p); err != nil {
+				return fmt.Errorf("profile %q for %s: %w", target, registry, err)
+			}
+		} else {
+			clientID = target
+		}
+	}
+	if clientID == "" {
+		return errDockerCredentialsNotFound
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRegistryHost(t *testing.T) {
+	tests := map[string]string{
+		"registry.example.com":                "registry.example.com",
+		"https://Registry.example.com/v1/":    "registry.example.com",
+		"registry.example.com:5000/namespace": "registry.example.com:5000",
+		"https://index.docker.io/v1/":         "index.docker.io",
+	}
+	for in, want := range tests {
+		if got := registryHost(in); got != want {
+			t.Errorf("registryHost(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestUseRegistry(t *testing.T) {
+	origServerURL, origClientID, origScope := serverURL, clientID, scope
+	defer func() { serverURL, clientID, scope = origServerURL, origClientID, origScope }()
+
+	cfg := &configFile{
+		Profiles: map[string]profile{
+			"staging": {
+				ServerURL: "https://auth.staging.example.com",
+				ClientID:  "staging-client",
+				Scope:     "registry:pull",
+			},
+		},
+		Registries: map[string]string{
+			"https://registry.staging.example.com": "staging",
+			"registry.example.com":                 "registry-client",
+		},
+	}
+
+	serverURL, clientID, scope = "https://auth.example.com", "", "read"
+	if err := useRegistry(cfg, "registry.staging.example.com"); err != nil {
+		t.Fatalf("useRegistry(staging) error = %v", err)
+	}
+	if serverURL != "https://auth.staging.example.com" || clientID != "staging-client" ||
+		scope != "registry:pull" {
+		t.Errorf("useRegistry(staging) left %s %s %q, want the staging profile",
+			serverURL, clientID, scope)
+	}
+
+	// A value set by environment variable wins over the profile.
+	t.Setenv("SCOPE", "ci")
+	serverURL, clientID, scope = "https://auth.example.com", "", "ci"
+	if err := useRegistry(cfg, "registry.staging.example.com"); err != nil {
+		t.Fatalf("useRegistry(staging) error = %v", err)
+	}
+	if clientID != "staging-client" || scope != "ci" {
+		t.Errorf("useRegistry(staging) with SCOPE set left %s %q, want staging-client \"ci\"",
+			clientID, scope)
+	}
+
+	serverURL, clientID, scope = "https://auth.example.com", "", "read"
+	if err := useRegistry(cfg, "https://registry.example.com/v2/"); err != nil {
+		t.Fatalf("useRegistry(client ID) error = %v", err)
+	}
+	if serverURL != "https://auth.example.com" || clientID != "registry-client" {
+		t.Errorf("useRegistry(client ID) left %s %s, want registry-client", serverURL, clientID)
+	}
+
+	clientID = ""
+	if err := useRegistry(cfg, "ghcr.io"); !errors.Is(err, errDockerCredentialsNotFound) {
+		t.Errorf("useRegistry(unmapped) error = %v, want %v", err, errDockerCredentialsNotFound)
+	}
+}
+
+func TestCmdDockerCredential(t *testing.T) {
+	origServerURL, origTokenFile, origClientID := serverURL, tokenFile, clientID
+	defer func() {
+		serverURL, tokenFile, clientID = origServerURL, origTokenFile, origClientID
+	}()
+	tokenFile = filepath.Join(t.TempDir(), "tokens.json")
+	clientID = ""
+
+	var revoked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth/revoke" {
+			http.NotFound(w, r)
+			return
+		}
+		revoked = append(revoked, r.FormValue("token"))
+	}))
+	defer server.Close()
+	serverURL = server.URL
+
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	if err := os.Mkdir(filepath.Join(configHome, "authgate"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(
+		filepath.Join(configHome, "authgate", "config.toml"),
+		[]byte("[registries]\n\"registry.example.com\" = \"docker-client\"\n"),
+		0o600,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	clientID = "docker-client"
+	if err := saveTokens(&TokenStorage{
+		AccessToken:  "docker-access-token",
+		RefreshToken: "docker-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("saveTokens() error = %v", err)
+	}
+	clientID = ""
+
+	var code int
+	out := withStdio(t, "https://registry.example.com\n", func() {
+		code = cmdDockerCredential(context.Background(), []string{"get"})
+	})
+	if code != exitOK {
+		t.Fatalf("get exited %d: %s", code, out)
+	}
+	var creds dockerCredentials
+	if err := json.Unmarshal([]byte(out), &creds); err != nil {
+		t.Fatalf("get wrote %q: %v", out, err)
+	}
+	want := dockerCredentials{
+		ServerURL: "https://registry.example.com",
+		Username:  defaultGitUsername,
+		Secret:    "docker-access-token",
+	}
+	if creds != want {
+		t.Errorf("get = %+v, want %+v", creds, want)
+	}
+
+	clientID = ""
+	out = withStdio(t, "ghcr.io\n", func() {
+		code = cmdDockerCredential(context.Background(), []string{"get"})
+	})
+	if code == exitOK || out != errDockerCredentialsNotFound.Error()+"\n" {
+		t.Errorf("get for an unmapped registry = %d, %q; want not found", code, out)
+	}
+
+	out = withStdio(t, "", func() {
+		code = cmdDockerCredential(context.Background(), []string{"list"})
+	})
+	var list map[string]string
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		t.Fatalf("list wrote %q: %v", out, err)
+	}
+	if code != exitOK || len(list) != 1 || list["registry.example.com"] != defaultGitUsername {
+		t.Errorf("list = %d, %v; want registry.example.com", code, list)
+	}
+
+	clientID = ""
+	withStdio(t, "registry.example.com\n", func() {
+		code = cmdDockerCredential(context.Background(), []string{"erase"})
+	})
+	if code != exitOK {
+		t.Fatalf("erase exited %d", code)
+	}
+	if _, err := loadTokens(); !isNotLoggedIn(err) {
+		t.Errorf("loadTokens() after erase error = %v, want not logged in", err)
+	}
+	wantRevoked := []string{"docker-refresh-token", "docker-access-token"}
+	if !slices.Equal(revoked, wantRevoked) {
+		t.Errorf("erase revoked %q, want %q", revoked, wantRevoked)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Environment variables set for the child process by the exec command.
+const (
+	envAccessToken = "AUTHGATE_ACCESS_TOKEN"
+	envTokenType   = "AUTHGATE_TOKEN_TYPE"
+	envExpiresAt   = "AUTHGATE_EXPIRES_AT"
+)
+
+// exitCommandNotFound matches the shell convention for a missing executable.
+const exitCommandNotFound = 127
+
+// forwardedSignals are relayed from the CLI to the child process.
+var forwardedSignals = []os.Signal{
+	os.Interrupt,
+	syscall.SIGTERM,
+	syscall.SIGHUP,
+	syscall.SIGQUIT,
+}
+
+// cmdExec obtains a valid access token and runs a child command with the token
+// in its environment, so credentials never touch disk or shell history.
+// The child's exit code is passed through.
+func cmdExec(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("exec", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	argv := flags.Args()
+	if len(argv) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: exec requires a command, e.g. exec -- terraform plan")
+		return exitUsage
+	}
+
+	storage, err := freshToken(ctx, refreshAhead)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCodeFor(err)
+	}
+
+	return runWithToken(storage, argv)
+}
+
+// runWithToken runs argv with the token exported into its environment,
+// forwarding signals until it exits, and returns its exit code.
+func runWithToken(storage *TokenStorage, argv []string) int {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = tokenEnv(os.Environ(), storage)
+
+	// Register before starting so no signal is lost between Start and Wait.
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, forwardedSignals...)
+	defer signal.Stop(sigCh)
+
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			return exitCommandNotFound
+		}
+		return exitError
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-sigCh:
+				_ = cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	close(done)
+	return childExitCode(err)
+}
+
+// childExitCode converts the result of cmd.Wait into an exit code, using the
+// shell convention of 128+signal for children killed by a signal.
+func childExitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return exitErr.ExitCode()
+}
+
+// tokenEnv returns environ with the AuthGate token variables set, replacing
+// any values inherited from the parent.
+func tokenEnv(environ []string, storage *TokenStorage) []string {
+	env := make([]string, 0, len(environ)+3)
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if name == envAccessToken || name == envTokenType || name == envExpiresAt {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return append(env,
+		envAccessToken+"="+storage.AccessToken,
+		envTokenType+"="+storage.TokenType,
+		envExpiresAt+"="+storage.Expiry().UTC().Format(time.RFC3339),
+	)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTokenEnv(t *testing.T) {
+	expiresAt := time.Date(2026, 1, 20, 12, 0, 0, 0, time.UTC)
+	storage := &TokenStorage{
+		AccessToken: "new-access-token",
+		TokenType:   "Bearer",
+		ExpiresAt:   expiresAt,
+	}
+
+	env := tokenEnv([]string{
+		"PATH=/usr/bin",
+		"AUTHGATE_ACCESS_TOKEN=stale-token",
+	}, storage)
+
+	want := []string{
+		"PATH=/usr/bin",
+		"AUTHGATE_ACCESS_TOKEN=new-access-token",
+		"AUTHGATE_TOKEN_TYPE=Bearer",
+		"AUTHGATE_EXPIRES_AT=2026-01-20T12:00:00Z",
+	}
+	if !slices.Equal(env, want) {
+		t.Errorf("tokenEnv() = %v, want %v", env, want)
+	}
+}
+
+func TestRunWithToken_ExitCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	storage := &TokenStorage{
+		AccessToken: "child-access-token",
+		TokenType:   "Bearer",
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+
+	tests := []struct {
+		name   string
+		script string
+		want   int
+	}{
+		{"success", "exit 0", exitOK},
+		{"exit code passthrough", "exit 42", 42},
+		{"token in environment", `test "$AUTHGATE_ACCESS_TOKEN" = child-access-token`, exitOK},
+		{"killed by signal", "kill -TERM $$", 128 + 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runWithToken(storage, []string{"sh", "-c", tt.script}); got != tt.want {
+				t.Errorf("runWithToken(%q) = %d, want %d", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunWithToken_CommandNotFound(t *testing.T) {
+	storage := &TokenStorage{AccessToken: "child-access-token"}
+	got := runWithToken(storage, []string{"authgate-no-such-command"})
+	if got != exitCommandNotFound {
+		t.Errorf("runWithToken() = %d, want %d", got, exitCommandNotFound)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultGitUsername is sent to git with the access token as password. Git
+// servers that accept bearer tokens ignore the username.
+const defaultGitUsername = "oauth2"
+
+// cmdGitCredential implements the git credential helper protocol, so that git
+// can authenticate to servers that accept AuthGate access tokens:
+//
+//	git config --global credential.https://git.example.com.helper \
+//	    "!authgate-device-cli git-credential"
+//
+// get answers with an access token obtained like the token command does,
+// running a device flow on stderr if needed. erase forgets the access token
+// git reports as rejected, so the next get refreshes it. store is a no-op as
+// tokens are saved when they are obtained.
+func cmdGitCredential(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("git-credential", flag.ContinueOnError)
+	username := flags.String(
+		"username",
+		defaultGitUsername,
+		"Username to pair with the access token",
+	)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Error: git-credential takes one operation: get, store or erase")
+		return exitUsage
+	}
+
+	request, err := readGitCredential(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	switch flags.Arg(0) {
+	case "get":
+		// Git owns stdin, but the device flow only needs the terminal on stderr.
+		storage, err := obtainToken(ctx, refreshAhead, isTTY())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitCodeFor(err)
+		}
+		err = writeGitCredential(os.Stdout, [][2]string{
+			{"username", *username},
+			{"password", storage.AccessToken},
+			{"password_expiry_utc", strconv.FormatInt(storage.Expiry().Unix(), 10)},
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	case "erase":
+		if password := request["password"]; password != "" {
+			if err := newClient().DiscardAccessToken(ctx, password); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return exitCodeFor(err)
+			}
+		}
+	}
+	// Unknown operations, including store, are ignored as the protocol asks.
+	return exitOK
+}
+
+// readGitCredential reads the key=value lines git sends to a helper, up to a
+// blank line or end of input. Repeated keys keep their last value.
+func readGitCredential(r io.Reader) (map[string]string, error) {
+	attrs := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid credential line %q", line)
+		}
+		attrs[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read credential request: %w", err)
+	}
+	return attrs, nil
+}
+
+// writeGitCredential writes attrs as key=value lines for git. Values that
+// would break the line-based protocol are rejected.
+func writeGitCredential(w io.Writer, attrs [][2]string) error {
+	var b strings.Builder
+	for _, attr := range attrs {
+		if strings.ContainsAny(attr[1], "\n\x00") {
+			return errors.New("credential " + attr[0] + " contains a newline or NUL byte")
+		}
+		b.WriteString(attr[0] + "=" + attr[1] + "\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadGitCredential(t *testing.T) {
+	input := "protocol=https\nhost=git.example.com\npath=org/repo.git\n" +
+		"password=a=b\n\nignored=after-blank-line\n"
+
+	attrs, err := readGitCredential(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("readGitCredential() error = %v", err)
+	}
+	want := map[string]string{
+		"protocol": "https",
+		"host":     "git.example.com",
+		"path":     "org/repo.git",
+		"password": "a=b",
+	}
+	if len(attrs) != len(want) {
+		t.Errorf("readGitCredential() = %v, want %v", attrs, want)
+	}
+	for key, value := range want {
+		if attrs[key] != value {
+			t.Errorf("%s = %q, want %q", key, attrs[key], value)
+		}
+	}
+
+	if _, err := readGitCredential(strings.NewReader("no-equals-sign\n")); err == nil {
+		t.Error("readGitCredential() accepted a line without '='")
+	}
+}
+
+func TestWriteGitCredential(t *testing.T) {
+	var b strings.Builder
+	err := writeGitCredential(&b, [][2]string{{"username", "oauth2"}, {"password", "tok"}})
+	if err != nil {
+		t.Fatalf("writeGitCredential() error = %v", err)
+	}
+	if got, want := b.String(), "username=oauth2\npassword=tok\n"; got != want {
+		t.Errorf("writeGitCredential() wrote %q, want %q", got, want)
+	}
+
+	err = writeGitCredential(io.Discard, [][2]string{{"username", "a\nhost=evil"}})
+	if err == nil {
+		t.Error("writeGitCredential() accepted a value with a newline")
+	}
+}
+
+// withStdio runs fn with stdin reading input and returns what fn wrote to
+// stdout.
+func withStdio(t *testing.T, input string, fn func()) string {
+	t.Helper()
+
+	in := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(in, []byte(input), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := os.Open(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origStdin, origStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdin, w
+	defer func() { os.Stdin, os.Stdout = origStdin, origStdout }()
+
+	fn()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestCmdGitCredential(t *testing.T) {
+	origTokenFile := tokenFile
+	origClientID := clientID
+	defer func() {
+		tokenFile = origTokenFile
+		clientID = origClientID
+	}()
+	tokenFile = filepath.Join(t.TempDir(), "tokens.json")
+	clientID = "test-client-git"
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := saveTokens(&TokenStorage{
+		AccessToken:  "saved-access-token",
+		RefreshToken: "saved-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    expiresAt,
+	}); err != nil {
+		t.Fatalf("saveTokens() error = %v", err)
+	}
+	request := "protocol=https\nhost=git.example.com\n\n"
+
+	var code int
+	out := withStdio(t, request, func() {
+		code = cmdGitCredential(context.Background(), []string{"-username=dev", "get"})
+	})
+	if code != exitOK {
+		t.Fatalf("get exited %d", code)
+	}
+	want := "username=dev\npassword=saved-access-token\npassword_expiry_utc=" +
+		strconv.FormatInt(expiresAt.Unix(), 10) + "\n"
+	if out != want {
+		t.Errorf("get wrote %q, want %q", out, want)
+	}
+
+	out = withStdio(t, request, func() {
+		code = cmdGitCredential(context.Background(), []string{"store"})
+	})
+	if code != exitOK || out != "" {
+		t.Errorf("store = %d, %q; want %d and no output", code, out, exitOK)
+	}
+
+	withStdio(t, "protocol=https\nhost=git.example.com\npassword=other-access-token\n", func() {
+		code = cmdGitCredential(context.Background(), []string{"erase"})
+	})
+	storage, err := loadTokens()
+	if err != nil {
+		t.Fatalf("loadTokens() error = %v", err)
+	}
+	if code != exitOK || storage.AccessToken != "saved-access-token" {
+		t.Errorf("erase of another token changed the saved token to %q", storage.AccessToken)
+	}
+
+	withStdio(t, "protocol=https\nhost=git.example.com\npassword=saved-access-token\n", func() {
+		code = cmdGitCredential(context.Background(), []string{"erase"})
+	})
+	if code != exitOK {
+		t.Fatalf("erase exited %d", code)
+	}
+	storage, err = loadTokens()
+	if err != nil {
+		t.Fatalf("loadTokens() error = %v", err)
+	}
+	if storage.AccessToken != "" || time.Now().Before(storage.ExpiresAt) {
+		t.Errorf("erase kept access token %q expiring %v", storage.AccessToken, storage.ExpiresAt)
+	}
+	if storage.RefreshToken != "saved-refresh-token" {
+		t.Errorf("erase dropped the refresh token: %q", storage.RefreshToken)
+	}
+}
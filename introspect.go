@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/go-authgate/device-cli/authgate"
+	"github.com/go-authgate/device-cli/tui"
+)
+
+// cmdIntrospect asks the server's RFC 7662 introspection endpoint about the
+// saved access token, or the refresh token with -refresh-token, and shows the
+// result as a table or, with -json, prints it to stdout. The saved token is
+// sent as is, so an access token that has expired is reported inactive. The
+// command exits with exitTokenInactive when the token is not active.
+func cmdIntrospect(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("introspect", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "Print the introspection response as JSON to stdout")
+	refreshToken := flags.Bool(
+		"refresh-token",
+		false,
+		"Introspect the refresh token instead of the access token",
+	)
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if !noArgs("introspect", flags.Args()) {
+		return exitUsage
+	}
+
+	storage, err := loadTokens()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCodeFor(err)
+	}
+	token, hint := storage.AccessToken, authgate.TokenTypeHintAccessToken
+	if *refreshToken {
+		token, hint = storage.RefreshToken, authgate.TokenTypeHintRefreshToken
+	}
+	if token == "" {
+		fmt.Fprintf(os.Stderr, "Error: no %s saved for client_id %s\n", hint, clientID)
+		return exitNeedsLogin
+	}
+
+	var info *authgate.Introspection
+	if *asJSON {
+		info, err = newClient().Introspect(ctx, token, hint)
+		if err == nil {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(info)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	} else {
+		err = withDisplayer(func(d tui.Displayer) error {
+			d.Verifying()
+			info, err = newClient().Introspect(ctx, token, hint)
+			if err != nil {
+				d.Fatal(err)
+				return err
+			}
+			d.Introspected(introspectionView(info))
+			return nil
+		})
+	}
+	if err != nil {
+		return exitCodeFor(err)
+	}
+	if !info.Active {
+		return exitTokenInactive
+	}
+	return exitOK
+}
+
+// introspectionView converts an introspection response for display.
+func introspectionView(info *authgate.Introspection) tui.Introspection {
+	return tui.Introspection{
+		Active:    info.Active,
+		Scope:     info.Scope,
+		ClientID:  info.ClientID,
+		Subject:   info.Subject,
+		Audience:  info.Audience,
+		ExpiresAt: info.Expiry(),
+	}
+}
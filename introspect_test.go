@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/device-cli/authgate"
+)
+
+func TestCmdIntrospect(t *testing.T) {
+	origServerURL, origClientID, origTokenFile := serverURL, clientID, tokenFile
+	defer func() {
+		serverURL = origServerURL
+		clientID = origClientID
+		tokenFile = origTokenFile
+	}()
+	tokenFile = filepath.Join(t.TempDir(), "tokens.json")
+	clientID = "test-client-introspect"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth/introspect" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.FormValue("token") != "active-access-token" {
+			_, _ = w.Write([]byte(`{"active":false}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"active":true,"scope":"read",` +
+			`"client_id":"test-client-introspect","sub":"user-1","aud":"api",` +
+			`"exp":4102444800}`))
+	}))
+	defer server.Close()
+	serverURL = server.URL
+
+	if err := saveTokens(&TokenStorage{
+		AccessToken:  "active-access-token",
+		RefreshToken: "revoked-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("saveTokens() error = %v", err)
+	}
+
+	var code int
+	out := withStdio(t, "", func() {
+		code = cmdIntrospect(context.Background(), []string{"-json"})
+	})
+	if code != exitOK {
+		t.Fatalf("introspect -json exited %d", code)
+	}
+	var info authgate.Introspection
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		t.Fatalf("introspect -json wrote %q: %v", out, err)
+	}
+	if !info.Active || info.Subject != "user-1" || info.ExpiresAt != 4102444800 {
+		t.Errorf("introspect -json = %+v, want the active token", info)
+	}
+
+	out = withStdio(t, "", func() {
+		code = cmdIntrospect(context.Background(), []string{"-json", "-refresh-token"})
+	})
+	if code != exitTokenInactive || out != "{\n  \"active\": false\n}\n" {
+		t.Errorf("introspect -refresh-token = %d, %q; want %d and an inactive token",
+			code, out, exitTokenInactive)
+	}
+
+	withStdio(t, "", func() {
+		code = cmdIntrospect(context.Background(), nil)
+	})
+	if code != exitOK {
+		t.Errorf("introspect exited %d, want %d", code, exitOK)
+	}
+}
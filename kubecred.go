@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// envKubernetesExecInfo is set by client-go to the ExecCredential request.
+const envKubernetesExecInfo = "KUBERNETES_EXEC_INFO"
+
+// execCredentialAPIVersion is the ExecCredential version written when
+// client-go does not send one.
+const execCredentialAPIVersion = "client.authentication.k8s.io/v1"
+
+// execCredential is the client-go ExecCredential object, read from
+// KUBERNETES_EXEC_INFO and written to stdout.
+type execCredential struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Spec       *execCredentialSpec   `json:"spec,omitempty"`
+	Status     *execCredentialStatus `json:"status,omitempty"`
+}
+
+type execCredentialSpec struct {
+	Interactive bool `json:"interactive"`
+}
+
+type execCredentialStatus struct {
+	Token               string `json:"token"`
+	ExpirationTimestamp string `json:"expirationTimestamp,omitempty"`
+}
+
+// cmdKubeCredential prints an ExecCredential holding the access token, so
+// kubectl can use the CLI as an exec credential plugin:
+//
+//	users:
+//	- name: authgate
+//	  user:
+//	    exec:
+//	      apiVersion: client.authentication.k8s.io/v1
+//	      command: authgate-device-cli
+//	      args: ["-client-id=abc-123", "kube-credential"]
+//	      interactiveMode: IfAvailable
+//
+// A device flow, shown on stderr, is only started when client-go reports the
+// plugin may interact with the user, or when KUBERNETES_EXEC_INFO is unset and
+// stderr is a terminal.
+func cmdKubeCredential(ctx context.Context, args []string) int {
+	if !noArgs("kube-credential", args) {
+		return exitUsage
+	}
+
+	info, err := readExecInfo(os.Getenv(envKubernetesExecInfo))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	canPrompt := isTTY()
+	if info.Spec != nil {
+		canPrompt = info.Spec.Interactive
+	}
+
+	storage, err := obtainToken(ctx, refreshAhead, canPrompt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCodeFor(err)
+	}
+
+	out := execCredential{
+		APIVersion: info.APIVersion,
+		Kind:       "ExecCredential",
+		Status:     &execCredentialStatus{Token: storage.AccessToken},
+	}
+	if expiry := storage.Expiry(); !expiry.IsZero() {
+		out.Status.ExpirationTimestamp = expiry.UTC().Format(time.RFC3339)
+	}
+	if err := json.NewEncoder(os.Stdout).Encode(out); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// readExecInfo parses the KUBERNETES_EXEC_INFO value. An empty value yields a
+// request without a spec for the default API version.
+func readExecInfo(value string) (*execCredential, error) {
+	info := &execCredential{APIVersion: execCredentialAPIVersion}
+	if value == "" {
+		return info, nil
+	}
+	if err := json.Unmarshal([]byte(value), info); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", envKubernetesExecInfo, err)
+	}
+	switch info.APIVersion {
+	case execCredentialAPIVersion, "client.authentication.k8s.io/v1beta1":
+	default:
+		return nil, fmt.Errorf("unsupported ExecCredential apiVersion %q", info.APIVersion)
+	}
+	return info, nil
+}
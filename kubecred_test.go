@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadExecInfo(t *testing.T) {
+	info, err := readExecInfo("")
+	if err != nil {
+		t.Fatalf("readExecInfo(\"\") error = %v", err)
+	}
+	if info.APIVersion != execCredentialAPIVersion || info.Spec != nil {
+		t.Errorf("readExecInfo(\"\") = %+v, want default version without spec", info)
+	}
+
+	info, err = readExecInfo(`{"apiVersion":"client.authentication.k8s.io/v1",` +
+		`"kind":"ExecCredential","spec":{"interactive":true,"cluster":{"server":"https://k8s"}}}`)
+	if err != nil {
+		t.Fatalf("readExecInfo() error = %v", err)
+	}
+	if info.Spec == nil || !info.Spec.Interactive {
+		t.Errorf("readExecInfo() spec = %+v, want interactive", info.Spec)
+	}
+
+	for _, value := range []string{
+		"not json",
+		`{"apiVersion":"client.authentication.k8s.io/v1alpha1","kind":"ExecCredential"}`,
+	} {
+		if _, err := readExecInfo(value); err == nil {
+			t.Errorf("readExecInfo(%q) accepted an invalid request", value)
+		}
+	}
+}
+
+func TestCmdKubeCredential(t *testing.T) {
+	origTokenFile, origClientID := tokenFile, clientID
+	defer func() { tokenFile, clientID = origTokenFile, origClientID }()
+	tokenFile = filepath.Join(t.TempDir(), "tokens.json")
+	clientID = "test-client-kube"
+	t.Setenv(envKubernetesExecInfo, `{"apiVersion":"client.authentication.k8s.io/v1beta1",`+
+		`"kind":"ExecCredential","spec":{"interactive":false}}`)
+
+	var code int
+	out := withStdio(t, "", func() {
+		code = cmdKubeCredential(context.Background(), nil)
+	})
+	if code != exitInteractive || out != "" {
+		t.Errorf("without tokens = %d, %q; want %d and no output", code, out, exitInteractive)
+	}
+
+	expiresAt := time.Date(2099, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := saveTokens(&TokenStorage{
+		AccessToken:  "kube-access-token",
+		RefreshToken: "kube-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    expiresAt,
+	}); err != nil {
+		t.Fatalf("saveTokens() error = %v", err)
+	}
+
+	out = withStdio(t, "", func() {
+		code = cmdKubeCredential(context.Background(), nil)
+	})
+	if code != exitOK {
+		t.Fatalf("kube-credential exited %d", code)
+	}
+	var cred execCredential
+	if err := json.Unmarshal([]byte(out), &cred); err != nil {
+		t.Fatalf("kube-credential wrote %q: %v", out, err)
+	}
+	if cred.APIVersion != "client.authentication.k8s.io/v1beta1" || cred.Kind != "ExecCredential" {
+		t.Errorf("kube-credential wrote %s %s, want the requested version",
+			cred.APIVersion, cred.Kind)
+	}
+	if cred.Status == nil || cred.Status.Token != "kube-access-token" ||
+		cred.Status.ExpirationTimestamp != "2099-01-02T03:04:05Z" {
+		t.Errorf("kube-credential status = %+v", cred.Status)
+	}
+}
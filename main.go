@@ -1,9 +1,8 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -12,8 +11,8 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
@@ -22,7 +21,7 @@ import (
 	"github.com/joho/godotenv"
 	"golang.org/x/oauth2"
 
-	tea "charm.land/bubbletea/v2"
+	"github.com/go-authgate/device-cli/authgate"
 	"github.com/go-authgate/device-cli/tui"
 )
 
@@ -30,26 +29,42 @@ var (
 	serverURL         string
 	clientID          string
 	tokenFile         string
+	tokenStore        string
+	tokenKeyFile      string
+	lockTimeout       time.Duration
+	refreshAhead      time.Duration
+	agentSocket       string
+	scope             string
+	profileName       string
+	flagProfile       *string
 	flagServerURL     *string
 	flagClientID      *string
 	flagTokenFile     *string
+	flagTokenStore    *string
+	flagTokenKeyFile  *string
+	flagLockTimeout   *string
+	flagRefreshAhead  *string
+	flagAgentSocket   *string
+	flagScope         *string
+	flagNoDiscovery   *bool
+	discoveryEnabled  bool
 	configInitialized bool
 	retryClient       *retry.Client
 )
 
-// Timeout configuration for different operations
-const (
-	deviceCodeRequestTimeout = 10 * time.Second
-	tokenExchangeTimeout     = 5 * time.Second
-	tokenVerificationTimeout = 10 * time.Second
-	refreshTokenTimeout      = 10 * time.Second
-)
+// tokenVerificationTimeout bounds each attempt of the demo API call
+const tokenVerificationTimeout = 10 * time.Second
 
 func init() {
 	// Load .env file if exists (ignore error if not found)
 	_ = godotenv.Load()
 
 	// Define flags (but don't parse yet to avoid conflicts with test flags)
+	flagProfile = flag.String(
+		"profile",
+		"",
+		"Config file profile to use (default: default_profile or AUTHGATE_PROFILE env)",
+	)
 	flagServerURL = flag.String(
 		"server-url",
 		"",
@@ -61,6 +76,42 @@ func init() {
 		"",
 		"Token storage file (default: .authgate-tokens.json or TOKEN_FILE env)",
 	)
+	flagTokenStore = flag.String(
+		"token-store",
+		"",
+		"Where to keep tokens: file, encrypted or keyring (default: file or TOKEN_STORE env)",
+	)
+	flagTokenKeyFile = flag.String(
+		"token-key-file",
+		"",
+		"Key file for -token-store=encrypted instead of a passphrase (or TOKEN_KEY_FILE env)",
+	)
+	flagLockTimeout = flag.String(
+		"lock-timeout",
+		"",
+		"How long to wait for the token file lock, e.g. 30s (default: 5s or LOCK_TIMEOUT env)",
+	)
+	flagRefreshAhead = flag.String(
+		"refresh-ahead",
+		"",
+		"Refresh tokens this long before they expire, e.g. 2m (default: 1m or REFRESH_AHEAD env)",
+	)
+	flagAgentSocket = flag.String(
+		"agent-socket",
+		"",
+		"Agent socket to ask for tokens before the token store (or AUTHGATE_AGENT_SOCK env)",
+	)
+	flagScope = flag.String(
+		"scope",
+		"",
+		"Space-separated OAuth scopes to request (default: \"read write\" or SCOPE env)",
+	)
+	flagNoDiscovery = flag.Bool(
+		"no-discovery",
+		false,
+		"Use built-in endpoint paths instead of server metadata discovery",
+	)
+	flag.Usage = usage
 }
 
 // initConfig parses flags and initializes configuration
@@ -73,10 +124,30 @@ func initConfig() {
 
 	flag.Parse()
 
-	// Priority: flag > env > default
-	serverURL = getConfig(*flagServerURL, "SERVER_URL", "http://localhost:8080")
-	clientID = getConfig(*flagClientID, "CLIENT_ID", "")
-	tokenFile = getConfig(*flagTokenFile, "TOKEN_FILE", ".authgate-tokens.json")
+	// Select the config file profile, if any
+	cfg, err := loadConfigFile(configFilePath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	active, name, err := cfg.selectProfile(getConfig(*flagProfile, "AUTHGATE_PROFILE", "", ""))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	profileName = name
+
+	// Priority: flag > env > profile > default
+	serverURL = getConfig(*flagServerURL, "SERVER_URL", active.ServerURL, "http://localhost:8080")
+	clientID = getConfig(*flagClientID, "CLIENT_ID", active.ClientID, "")
+	tokenFile = getConfig(
+		*flagTokenFile, "TOKEN_FILE", active.TokenFile, ".authgate-tokens.json",
+	)
+	tokenStore = getConfig(*flagTokenStore, "TOKEN_STORE", active.TokenStore, tokenStoreFile)
+	tokenKeyFile = getConfig(*flagTokenKeyFile, "TOKEN_KEY_FILE", active.TokenKeyFile, "")
+	scope = getConfig(*flagScope, "SCOPE", active.Scope, "read write")
+	agentSocket = getConfig(*flagAgentSocket, envAgentSocket, "", "")
+	discoveryEnabled = !*flagNoDiscovery
 
 	// Validate SERVER_URL format
 	if err := validateServerURL(serverURL); err != nil {
@@ -84,6 +155,37 @@ func initConfig() {
 		os.Exit(1)
 	}
 
+	lockTimeout, err = time.ParseDuration(
+		getConfig(*flagLockTimeout, "LOCK_TIMEOUT", "", authgate.DefaultLockTimeout.String()),
+	)
+	if err != nil || lockTimeout <= 0 {
+		fmt.Fprintln(
+			os.Stderr,
+			"Error: Invalid LOCK_TIMEOUT: must be a positive duration such as 10s",
+		)
+		os.Exit(1)
+	}
+
+	refreshAhead, err = time.ParseDuration(getConfig(
+		*flagRefreshAhead, "REFRESH_AHEAD", "", authgate.DefaultRefreshAhead.String(),
+	))
+	if err != nil || refreshAhead <= 0 {
+		fmt.Fprintln(
+			os.Stderr,
+			"Error: Invalid REFRESH_AHEAD: must be a positive duration such as 1m",
+		)
+		os.Exit(1)
+	}
+
+	if !slices.Contains(tokenStores, tokenStore) {
+		fmt.Fprintf(
+			os.Stderr,
+			"Error: Invalid TOKEN_STORE %q (expected one of: %s)\n",
+			tokenStore, strings.Join(tokenStores, ", "),
+		)
+		os.Exit(1)
+	}
+
 	// Warn if using HTTP instead of HTTPS
 	if strings.HasPrefix(strings.ToLower(serverURL), "http://") {
 		fmt.Fprintln(
@@ -97,17 +199,18 @@ func initConfig() {
 		fmt.Fprintln(os.Stderr)
 	}
 
-	if clientID == "" {
+	if clientID == "" && needsClientID(commandArgs()) {
 		fmt.Println("Error: CLIENT_ID not set. Please provide it via:")
 		fmt.Println("  1. Command line flag: -client-id=<your-client-id>")
 		fmt.Println("  2. Environment variable: CLIENT_ID=<your-client-id>")
 		fmt.Println("  3. .env file: CLIENT_ID=<your-client-id>")
+		fmt.Println("  4. Config file profile: client_id in " + configFilePath())
 		fmt.Println("\nYou can find the client_id in the server startup logs.")
 		os.Exit(1)
 	}
 
 	// Validate CLIENT_ID format (should be UUID)
-	if _, err := uuid.Parse(clientID); err != nil {
+	if _, err := uuid.Parse(clientID); clientID != "" && err != nil {
 		fmt.Fprintf(
 			os.Stderr,
 			"⚠️  Warning: CLIENT_ID doesn't appear to be a valid UUID: %s\n",
@@ -121,33 +224,20 @@ func initConfig() {
 	}
 
 	// Initialize HTTP client with retry support
-	baseHTTPClient := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				MinVersion: tls.VersionTLS12,
-			},
-			MaxIdleConns:        10,
-			IdleConnTimeout:     90 * time.Second,
-			TLSHandshakeTimeout: 10 * time.Second,
-			DisableKeepAlives:   false,
-		},
-	}
-
-	// Wrap with retry logic using go-httpretry
-	var err error
-	retryClient, err = retry.NewBackgroundClient(
-		retry.WithHTTPClient(baseHTTPClient),
-	)
+	retryClient, err = authgate.NewHTTPClient()
 	if err != nil {
 		panic(fmt.Sprintf("failed to create retry client: %v", err))
 	}
 }
 
-// getConfig returns value with priority: flag > env > default
-func getConfig(flagValue, envKey, defaultValue string) string {
+// getConfig returns value with priority: flag > env > profile > default
+func getConfig(flagValue, envKey, profileValue, defaultValue string) string {
 	if flagValue != "" {
 		return flagValue
 	}
+	if profileValue != "" {
+		defaultValue = profileValue
+	}
 	return getEnv(envKey, defaultValue)
 }
 
@@ -180,48 +270,35 @@ func validateServerURL(rawURL string) error {
 	return nil
 }
 
-type ErrorResponse struct {
-	Error            string `json:"error"`
-	ErrorDescription string `json:"error_description"`
-}
-
-// ErrRefreshTokenExpired indicates that the refresh token has expired or is invalid
-var ErrRefreshTokenExpired = errors.New("refresh token expired or invalid")
-
-// validateTokenResponse validates the OAuth token response
-func validateTokenResponse(accessToken, tokenType string, expiresIn int) error {
-	if accessToken == "" {
-		return errors.New("access_token is empty")
-	}
-
-	if len(accessToken) < 10 {
-		return fmt.Errorf("access_token is too short (length: %d)", len(accessToken))
-	}
-
-	if expiresIn <= 0 {
-		return fmt.Errorf("expires_in must be positive, got: %d", expiresIn)
-	}
-
-	// Token type is optional in OAuth 2.0, but if present, should be "Bearer"
-	if tokenType != "" && tokenType != "Bearer" {
-		return fmt.Errorf("unexpected token_type: %s (expected Bearer)", tokenType)
-	}
-
-	return nil
-}
+// Aliases for the types and errors now provided by the authgate package.
+type (
+	TokenStorage    = authgate.TokenStorage
+	TokenStorageMap = authgate.TokenStorageMap
+)
 
-// TokenStorage represents saved tokens for a specific client
-type TokenStorage struct {
-	AccessToken  string    `json:"access_token"`
-	RefreshToken string    `json:"refresh_token"`
-	TokenType    string    `json:"token_type"`
-	ExpiresAt    time.Time `json:"expires_at"`
-	ClientID     string    `json:"client_id"`
-}
+var (
+	ErrRefreshTokenExpired = authgate.ErrRefreshTokenExpired
+	ErrNoTokens            = authgate.ErrNoTokens
+)
 
-// TokenStorageMap manages tokens for multiple clients
-type TokenStorageMap struct {
-	Tokens map[string]*TokenStorage `json:"tokens"` // key = client_id
+// newClient returns an authgate.Client for the current configuration.
+func newClient() *authgate.Client {
+	c := &authgate.Client{
+		ServerURL:    serverURL,
+		ClientID:     clientID,
+		TokenFile:    tokenFile,
+		HTTPClient:   retryClient,
+		Store:        newTokenStore(),
+		AgentSocket:  agentSocket,
+		Scopes:       strings.Fields(scope),
+		Discovery:    discoveryEnabled,
+		RefreshAhead: refreshAhead,
+	}
+	if discoveryEnabled {
+		c.MetadataCacheFile = authgate.DefaultMetadataCachePath(serverURL)
+	}
+	c.JWKSCacheFile = authgate.DefaultJWKSCachePath(serverURL)
+	return c
 }
 
 // isTTY reports whether stderr is a character device (interactive terminal).
@@ -234,38 +311,19 @@ func isTTY() bool {
 	return (fi.Mode() & os.ModeCharDevice) != 0
 }
 
+// isInteractive reports whether both stdin and stderr are terminals, meaning a
+// user is present to complete a device flow.
+func isInteractive() bool {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return (fi.Mode()&os.ModeCharDevice) != 0 && isTTY()
+}
+
 func main() {
 	initConfig()
-
-	if isTTY() {
-		// Run TUI program on stderr so stdout pipes are not corrupted
-		m := tui.NewModel()
-		// WithInput(nil): disable stdin/keyboard input so BubbleTea skips terminal
-		// capability queries (?2026/?2027). Ctrl+C is handled by signal.NotifyContext.
-		p := tea.NewProgram(m, tea.WithOutput(os.Stderr), tea.WithInput(nil))
-
-		var wg sync.WaitGroup
-		wg.Go(func() {
-			if _, err := p.Run(); err != nil {
-				fmt.Fprintf(os.Stderr, "TUI error: %v\n", err)
-			}
-		})
-
-		d := tui.NewProgramDisplayer(p)
-		d.Banner()
-		runErr := run(d)
-		p.Quit() // let BubbleTea drain terminal query responses before exiting
-		wg.Wait()
-		if runErr != nil {
-			os.Exit(1)
-		}
-	} else {
-		d := tui.NewPlainDisplayer(os.Stderr)
-		d.Banner()
-		if err := run(d); err != nil {
-			os.Exit(1)
-		}
-	}
+	os.Exit(runCommand(commandArgs()))
 }
 
 func run(d tui.Displayer) error {
@@ -279,8 +337,11 @@ func run(d tui.Displayer) error {
 	if err == nil && storage != nil {
 		d.TokensFound()
 
-		// Check if access token is still valid
-		if time.Now().Before(storage.ExpiresAt) {
+		// Check that the saved token covers the requested scopes and is still valid
+		if missing := storage.MissingScopes(strings.Fields(scope)); len(missing) > 0 {
+			d.ScopeMissing(missing)
+			storage = nil // Force device flow
+		} else if storage.Valid(refreshAhead) {
 			d.TokenValid()
 		} else {
 			d.TokenExpired()
@@ -310,11 +371,7 @@ func run(d tui.Displayer) error {
 	}
 
 	// Display current token info
-	tokenPreview := storage.AccessToken
-	if len(tokenPreview) > 50 {
-		tokenPreview = tokenPreview[:50]
-	}
-	d.Done(tokenPreview, storage.TokenType, time.Until(storage.ExpiresAt).Round(time.Second))
+	showDone(d, storage)
 
 	// Verify token
 	d.Verifying()
@@ -325,7 +382,7 @@ func run(d tui.Displayer) error {
 	// Demonstrate automatic refresh on 401
 	if err := makeAPICallWithAutoRefresh(ctx, storage, d); err != nil {
 		// Check if error is due to expired refresh token
-		if err == ErrRefreshTokenExpired {
+		if errors.Is(err, ErrRefreshTokenExpired) {
 			d.ReAuthRequired()
 			storage, err = performDeviceFlow(ctx, d)
 			if err != nil {
@@ -350,294 +407,56 @@ func run(d tui.Displayer) error {
 
 // requestDeviceCode requests a device code from the OAuth server with retry logic
 func requestDeviceCode(ctx context.Context) (*oauth2.DeviceAuthResponse, error) {
-	// Create request with timeout
-	reqCtx, cancel := context.WithTimeout(ctx, deviceCodeRequestTimeout)
-	defer cancel()
-
-	data := url.Values{}
-	data.Set("client_id", clientID)
-	data.Set("scope", "read write")
-
-	req, err := http.NewRequestWithContext(
-		reqCtx,
-		http.MethodPost,
-		serverURL+"/oauth/device/code",
-		strings.NewReader(data.Encode()),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create device code request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	// Execute request with retry logic
-	resp, err := retryClient.DoWithContext(reqCtx, req)
-	if err != nil {
-		return nil, fmt.Errorf("device code request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf(
-			"device code request failed with status %d: %s",
-			resp.StatusCode,
-			string(body),
-		)
-	}
-
-	// Parse response
-	var deviceResp struct {
-		DeviceCode              string `json:"device_code"`
-		UserCode                string `json:"user_code"`
-		VerificationURI         string `json:"verification_uri"`
-		VerificationURIComplete string `json:"verification_uri_complete"`
-		ExpiresIn               int    `json:"expires_in"`
-		Interval                int    `json:"interval"`
-	}
-
-	if err := json.Unmarshal(body, &deviceResp); err != nil {
-		return nil, fmt.Errorf("failed to parse device code response: %w", err)
-	}
-
-	return &oauth2.DeviceAuthResponse{
-		DeviceCode:              deviceResp.DeviceCode,
-		UserCode:                deviceResp.UserCode,
-		VerificationURI:         deviceResp.VerificationURI,
-		VerificationURIComplete: deviceResp.VerificationURIComplete,
-		Expiry:                  time.Now().Add(time.Duration(deviceResp.ExpiresIn) * time.Second),
-		Interval:                int64(deviceResp.Interval),
-	}, nil
+	return newClient().RequestDeviceCode(ctx)
 }
 
 // performDeviceFlow performs the OAuth device authorization flow
 func performDeviceFlow(ctx context.Context, d tui.Displayer) (*TokenStorage, error) {
-	config := &oauth2.Config{
-		ClientID: clientID,
-		Endpoint: oauth2.Endpoint{
-			DeviceAuthURL: serverURL + "/oauth/device/code",
-			TokenURL:      serverURL + "/oauth/token",
-		},
-		Scopes: []string{"read", "write"},
-	}
-
-	// Step 1: Request device code (with retry logic)
-	deviceAuth, err := requestDeviceCode(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("device code request failed: %w", err)
-	}
-
-	d.DeviceCodeReady(
-		deviceAuth.UserCode,
-		deviceAuth.VerificationURI,
-		deviceAuth.VerificationURIComplete,
-		deviceAuth.Expiry,
-	)
+	return newClient().PerformDeviceFlow(ctx, d)
+}
 
-	// Step 2: Poll for token
-	d.WaitingForAuth()
-	token, err := pollForTokenWithProgress(ctx, config, deviceAuth, d)
+func verifyToken(ctx context.Context, accessToken string, d tui.Displayer) error {
+	body, err := newClient().TokenInfo(ctx, accessToken)
 	if err != nil {
-		return nil, fmt.Errorf("token poll failed: %w", err)
-	}
-
-	d.AuthSuccess()
-
-	// Convert to TokenStorage and save
-	storage := &TokenStorage{
-		AccessToken:  token.AccessToken,
-		RefreshToken: token.RefreshToken,
-		TokenType:    token.Type(),
-		ExpiresAt:    token.Expiry,
-		ClientID:     clientID,
+		return err
 	}
 
-	if err := saveTokens(storage); err != nil {
-		d.TokenSaveFailed(err)
-	} else {
-		d.TokenSaved(tokenFile)
-	}
+	d.VerifyOK(body)
+	return nil
+}
 
-	return storage, nil
+// loadTokens loads tokens from file for the current client
+func loadTokens() (*TokenStorage, error) {
+	return newClient().LoadTokens()
 }
 
-// pollForTokenWithProgress polls for token while reporting progress via Displayer.
-// Implements exponential backoff for slow_down errors per RFC 8628.
-func pollForTokenWithProgress(
-	ctx context.Context,
-	config *oauth2.Config,
-	deviceAuth *oauth2.DeviceAuthResponse,
-	d tui.Displayer,
-) (*oauth2.Token, error) {
-	// Initial polling interval (from DeviceAuthResponse)
-	interval := deviceAuth.Interval
-	if interval == 0 {
-		interval = 5 // Default to 5 seconds per RFC 8628
-	}
-
-	// Exponential backoff state
-	pollInterval := time.Duration(interval) * time.Second
-	backoffMultiplier := 1.0
-
-	pollTicker := time.NewTicker(pollInterval)
-	defer pollTicker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-
-		case <-pollTicker.C:
-			// Attempt to exchange device code for token
-			token, err := exchangeDeviceCode(
-				ctx,
-				config.Endpoint.TokenURL,
-				config.ClientID,
-				deviceAuth.DeviceCode,
-			)
-			if err != nil {
-				var oauthErr *oauth2.RetrieveError
-				if errors.As(err, &oauthErr) {
-					// Parse OAuth error response
-					var errResp ErrorResponse
-					if jsonErr := json.Unmarshal(oauthErr.Body, &errResp); jsonErr == nil {
-						switch errResp.Error {
-						case "authorization_pending":
-							// User hasn't authorized yet, continue polling
-							continue
-
-						case "slow_down":
-							// Server requests slower polling - increase interval
-							backoffMultiplier *= 1.5
-							pollInterval = min(
-								time.Duration(float64(pollInterval)*backoffMultiplier),
-								60*time.Second,
-							)
-							pollTicker.Reset(pollInterval)
-							d.PollSlowDown(pollInterval)
-							continue
-
-						case "expired_token":
-							return nil, errors.New("device code expired, please restart the flow")
-
-						case "access_denied":
-							return nil, errors.New("user denied authorization")
-
-						default:
-							return nil, fmt.Errorf(
-								"authorization failed: %s - %s",
-								errResp.Error,
-								errResp.ErrorDescription,
-							)
-						}
-					}
-				}
-				// Unknown error
-				return nil, fmt.Errorf("token exchange failed: %w", err)
-			}
+// saveTokens saves tokens to file (merges with existing tokens for other clients)
+func saveTokens(storage *TokenStorage) error {
+	return newClient().SaveTokens(storage)
+}
 
-			// Success!
-			return token, nil
-		}
-	}
+// deleteTokens removes the current client's tokens, reporting whether an entry existed.
+func deleteTokens() (bool, error) {
+	return newClient().DeleteTokens()
 }
 
-// exchangeDeviceCode exchanges device code for access token
-func exchangeDeviceCode(
+// refreshAccessToken refreshes the access token using refresh token
+func refreshAccessToken(
 	ctx context.Context,
-	tokenURL, clientID, deviceCode string,
-) (*oauth2.Token, error) {
-	// Create request with timeout
-	reqCtx, cancel := context.WithTimeout(ctx, tokenExchangeTimeout)
-	defer cancel()
-
-	data := url.Values{}
-	data.Set("grant_type", "urn:ietf:params:oauth:grant-type:device_code")
-	data.Set("device_code", deviceCode)
-	data.Set("client_id", clientID)
-
-	req, err := http.NewRequestWithContext(
-		reqCtx,
-		http.MethodPost,
-		tokenURL,
-		strings.NewReader(data.Encode()),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	resp, err := retryClient.DoWithContext(reqCtx, req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	// Handle non-200 responses
-	if resp.StatusCode != http.StatusOK {
-		return nil, &oauth2.RetrieveError{
-			Response: resp,
-			Body:     body,
-		}
-	}
-
-	// Parse successful token response
-	var tokenResp struct {
-		AccessToken  string `json:"access_token"`
-		RefreshToken string `json:"refresh_token"`
-		TokenType    string `json:"token_type"`
-		ExpiresIn    int    `json:"expires_in"`
-		Scope        string `json:"scope"`
-	}
-
-	if err := json.Unmarshal(body, &tokenResp); err != nil {
-		return nil, fmt.Errorf("failed to parse token response: %w", err)
-	}
-
-	// Validate token response
-	if err := validateTokenResponse(
-		tokenResp.AccessToken,
-		tokenResp.TokenType,
-		tokenResp.ExpiresIn,
-	); err != nil {
-		return nil, fmt.Errorf("invalid token response: %w", err)
-	}
-
-	token := &oauth2.Token{
-		AccessToken:  tokenResp.AccessToken,
-		RefreshToken: tokenResp.RefreshToken,
-		TokenType:    tokenResp.TokenType,
-		Expiry:       time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
-	}
-
-	return token, nil
+	refreshToken string,
+	d tui.Displayer,
+) (*TokenStorage, error) {
+	return newClient().RefreshAccessToken(ctx, refreshToken, d)
 }
 
-func verifyToken(ctx context.Context, accessToken string, d tui.Displayer) error {
-	// Create request with timeout
-	reqCtx, cancel := context.WithTimeout(ctx, tokenVerificationTimeout)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(
-		reqCtx, http.MethodGet, serverURL+"/oauth/tokeninfo", nil,
+// makeAPICallWithAutoRefresh demonstrates automatic refresh on 401
+func makeAPICallWithAutoRefresh(ctx context.Context, storage *TokenStorage, d tui.Displayer) error {
+	resp, err := doWithAutoRefresh(
+		ctx, storage, http.MethodGet, serverURL+"/oauth/tokeninfo",
+		nil, nil, tokenVerificationTimeout, d,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	// Execute request with retry logic
-	resp, err := retryClient.DoWithContext(reqCtx, req)
-	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
@@ -647,271 +466,112 @@ func verifyToken(ctx context.Context, accessToken string, d tui.Displayer) error
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		var errResp ErrorResponse
-		if err := json.Unmarshal(body, &errResp); err != nil {
-			return fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
-		}
-		return fmt.Errorf("%s: %s", errResp.Error, errResp.ErrorDescription)
+		return fmt.Errorf("API call failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
-	d.VerifyOK(string(body))
+	d.APICallOK()
 	return nil
 }
 
-// loadTokens loads tokens from file for the current client
-func loadTokens() (*TokenStorage, error) {
-	data, err := os.ReadFile(tokenFile)
+// doWithAutoRefresh sends an authenticated request with storage's access token.
+// If the server answers 401, the token is replaced once, from the agent when
+// one is running or else by a refresh, and the request is replayed with the
+// new token. Each attempt is bounded by timeout, which also
+// covers reading the response body; the caller must close the body.
+// Returns ErrRefreshTokenExpired when the refresh token is no longer accepted
+// or no tokens are saved.
+func doWithAutoRefresh(
+	ctx context.Context,
+	storage *TokenStorage,
+	method, rawURL string,
+	body []byte,
+	header http.Header,
+	timeout time.Duration,
+	d tui.Displayer,
+) (*http.Response, error) {
+	// Try with current access token
+	resp, err := sendWithToken(ctx, storage, method, rawURL, body, header, timeout)
 	if err != nil {
-		return nil, err
-	}
-
-	var storageMap TokenStorageMap
-	if err := json.Unmarshal(data, &storageMap); err != nil {
-		return nil, fmt.Errorf("failed to parse token file: %w", err)
+		return nil, fmt.Errorf("API request failed: %w", err)
 	}
 
-	if storageMap.Tokens == nil {
-		return nil, errors.New("no tokens found in token file")
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
 	}
 
-	// Look up token for current client_id
-	if storage, ok := storageMap.Tokens[clientID]; ok {
-		return storage, nil
-	}
-
-	return nil, fmt.Errorf("no tokens found for client_id: %s", clientID)
-}
-
-// saveTokens saves tokens to file (merges with existing tokens for other clients)
-// Uses file locking to prevent race conditions when multiple processes access the same file
-func saveTokens(storage *TokenStorage) error {
-	// Ensure ClientID is set
-	if storage.ClientID == "" {
-		storage.ClientID = clientID
-	}
+	// If 401, try to refresh and retry
+	resp.Body.Close()
+	d.AccessTokenRejected()
 
-	// Acquire file lock to prevent concurrent access
-	lock, err := acquireFileLock(tokenFile)
+	newStorage, err := newClient().RefreshRejected(ctx, storage.AccessToken)
 	if err != nil {
-		return fmt.Errorf("failed to acquire lock: %w", err)
-	}
-	defer func() {
-		if releaseErr := lock.release(); releaseErr != nil {
-			fmt.Fprintf(os.Stderr, "failed to release lock: %v\n", releaseErr)
-		}
-	}()
-
-	// Load existing token map (inside lock to ensure consistency)
-	var storageMap TokenStorageMap
-	existingData, err := os.ReadFile(tokenFile)
-	if err == nil {
-		// File exists, try to load it
-		if unmarshalErr := json.Unmarshal(existingData, &storageMap); unmarshalErr != nil {
-			// If unmarshal fails, start with empty map
-			storageMap.Tokens = make(map[string]*TokenStorage)
+		// If refresh token is expired, propagate the error to trigger device flow
+		if errors.Is(err, ErrRefreshTokenExpired) || errors.Is(err, authgate.ErrLoginRequired) {
+			return nil, ErrRefreshTokenExpired
 		}
+		return nil, fmt.Errorf("refresh failed: %w", err)
 	}
 
-	// Initialize map if nil
-	if storageMap.Tokens == nil {
-		storageMap.Tokens = make(map[string]*TokenStorage)
-	}
+	// Update storage in memory
+	// Note: a refreshed newStorage has already been saved by RefreshRejected()
+	*storage = *newStorage
 
-	// Add or update token for current client
-	storageMap.Tokens[storage.ClientID] = storage
+	d.TokenRefreshedRetrying()
 
-	// Marshal data
-	data, err := json.MarshalIndent(storageMap, "", "  ")
+	// Retry with new token
+	resp, err = sendWithToken(ctx, storage, method, rawURL, body, header, timeout)
 	if err != nil {
-		return err
-	}
-
-	// Write to temp file first (atomic write pattern)
-	tempFile := tokenFile + ".tmp"
-	if err := os.WriteFile(tempFile, data, 0o600); err != nil {
-		return fmt.Errorf("failed to write temp file: %w", err)
-	}
-
-	// Atomic rename (replaces old file)
-	if err := os.Rename(tempFile, tokenFile); err != nil {
-		if removeErr := os.Remove(tempFile); removeErr != nil {
-			return fmt.Errorf(
-				"failed to rename temp file: %v; additionally failed to remove temp file: %w",
-				err,
-				removeErr,
-			)
-		}
-		return fmt.Errorf("failed to rename temp file: %w", err)
+		return nil, fmt.Errorf("retry failed: %w", err)
 	}
-
-	return nil
+	return resp, nil
 }
 
-// refreshAccessToken refreshes the access token using refresh token
-func refreshAccessToken(
+// sendWithToken performs a single bearer-authenticated request through retryClient.
+func sendWithToken(
 	ctx context.Context,
-	refreshToken string,
-	d tui.Displayer,
-) (*TokenStorage, error) {
-	// Create request with timeout
-	reqCtx, cancel := context.WithTimeout(ctx, refreshTokenTimeout)
-	defer cancel()
-
-	data := url.Values{}
-	data.Set("grant_type", "refresh_token")
-	data.Set("refresh_token", refreshToken)
-	data.Set("client_id", clientID)
-
-	req, err := http.NewRequestWithContext(
-		reqCtx,
-		http.MethodPost,
-		serverURL+"/oauth/token",
-		strings.NewReader(data.Encode()),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	storage *TokenStorage,
+	method, rawURL string,
+	body []byte,
+	header http.Header,
+	timeout time.Duration,
+) (*http.Response, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, timeout)
 
-	// Execute request with retry logic
-	resp, err := retryClient.DoWithContext(reqCtx, req)
-	if err != nil {
-		return nil, fmt.Errorf("refresh request failed: %w", err)
+	// A bytes.Reader body lets NewRequest set GetBody, so retries can replay it
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	req, err := http.NewRequestWithContext(reqCtx, method, rawURL, bodyReader)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		cancel()
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-
-	if resp.StatusCode != http.StatusOK {
-		var errResp ErrorResponse
-		if err := json.Unmarshal(body, &errResp); err == nil {
-			// Check if refresh token is expired or invalid
-			if errResp.Error == "invalid_grant" || errResp.Error == "invalid_token" {
-				return nil, ErrRefreshTokenExpired
-			}
-			return nil, fmt.Errorf("%s: %s", errResp.Error, errResp.ErrorDescription)
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
 		}
-		return nil, fmt.Errorf("refresh failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
-	// Parse token response
-	var tokenResp struct {
-		AccessToken  string `json:"access_token"`
-		RefreshToken string `json:"refresh_token"`
-		TokenType    string `json:"token_type"`
-		ExpiresIn    int    `json:"expires_in"`
-	}
-
-	if err := json.Unmarshal(body, &tokenResp); err != nil {
-		return nil, fmt.Errorf("failed to parse token response: %w", err)
-	}
-
-	// Validate token response
-	if err := validateTokenResponse(
-		tokenResp.AccessToken,
-		tokenResp.TokenType,
-		tokenResp.ExpiresIn,
-	); err != nil {
-		return nil, fmt.Errorf("invalid token response: %w", err)
-	}
-
-	// Handle refresh token rotation modes:
-	// - Rotation mode: Server returns new refresh_token (use it)
-	// - Fixed mode: Server doesn't return refresh_token (preserve old one)
-	newRefreshToken := tokenResp.RefreshToken
-	if newRefreshToken == "" {
-		// Server didn't return a new refresh token (fixed mode)
-		newRefreshToken = refreshToken
-	}
-
-	storage := &TokenStorage{
-		AccessToken:  tokenResp.AccessToken,
-		RefreshToken: newRefreshToken,
-		TokenType:    tokenResp.TokenType,
-		ExpiresAt:    time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
-		ClientID:     clientID,
-	}
-
-	// Save updated tokens
-	if err := saveTokens(storage); err != nil {
-		d.TokenSaveFailed(err)
-	}
-
-	return storage, nil
-}
-
-// makeAPICallWithAutoRefresh demonstrates automatic refresh on 401
-func makeAPICallWithAutoRefresh(ctx context.Context, storage *TokenStorage, d tui.Displayer) error {
-	// Try with current access token
-	reqCtx, cancel := context.WithTimeout(ctx, tokenVerificationTimeout)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(
-		reqCtx, http.MethodGet, serverURL+"/oauth/tokeninfo", nil,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+storage.AccessToken)
 
 	resp, err := retryClient.DoWithContext(reqCtx, req)
 	if err != nil {
-		return fmt.Errorf("API request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// If 401, try to refresh and retry
-	if resp.StatusCode == http.StatusUnauthorized {
-		d.AccessTokenRejected()
-
-		newStorage, err := refreshAccessToken(ctx, storage.RefreshToken, d)
-		if err != nil {
-			// If refresh token is expired, propagate the error to trigger device flow
-			if err == ErrRefreshTokenExpired {
-				return ErrRefreshTokenExpired
-			}
-			return fmt.Errorf("refresh failed: %w", err)
-		}
-
-		// Update storage in memory
-		// Note: newStorage has already been saved to disk by refreshAccessToken()
-		storage.AccessToken = newStorage.AccessToken
-		storage.RefreshToken = newStorage.RefreshToken
-		storage.ExpiresAt = newStorage.ExpiresAt
-
-		d.TokenRefreshedRetrying()
-
-		// Retry with new token
-		retryCtx, retryCancel := context.WithTimeout(ctx, tokenVerificationTimeout)
-		defer retryCancel()
-
-		req, err = http.NewRequestWithContext(
-			retryCtx, http.MethodGet, serverURL+"/oauth/tokeninfo", nil,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to create retry request: %w", err)
-		}
-		req.Header.Set("Authorization", "Bearer "+storage.AccessToken)
-
-		resp, err = retryClient.DoWithContext(retryCtx, req)
-		if err != nil {
-			return fmt.Errorf("retry failed: %w", err)
-		}
-		defer resp.Body.Close()
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+		cancel()
+		return nil, err
 	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("API call failed with status %d: %s", resp.StatusCode, string(body))
-	}
+// cancelOnClose releases a request context once the response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
 
-	d.APICallOK()
-	return nil
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
 }
@@ -14,6 +14,7 @@ import (
 	"time"
 
 	retry "github.com/appleboy/go-httpretry"
+	"github.com/go-authgate/device-cli/authgate"
 	"github.com/go-authgate/device-cli/tui"
 )
 
@@ -85,7 +86,7 @@ func TestSaveTokens_ConcurrentWrites(t *testing.T) {
 	// Verify each token
 	for i := range goroutines {
 		clientID := fmt.Sprintf("client-%d", i)
-		token, ok := storageMap.Tokens[clientID]
+		token, ok := storageMap.Tokens[authgate.TokenKey(serverURL, clientID)]
 		if !ok {
 			t.Errorf("Missing token for client %s", clientID)
 			continue
@@ -102,10 +103,92 @@ func TestSaveTokens_ConcurrentWrites(t *testing.T) {
 		}
 	}
 
-	// Verify no lock files remain
-	lockPath := tokenFile + ".lock"
-	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
-		t.Errorf("Lock file still exists after all saves completed")
+	// Verify the lock is free once all saves completed
+	if _, err := deleteTokens(); err != nil {
+		t.Errorf("Lock still held after all saves completed: %v", err)
+	}
+
+	t.Run("refresh contention", testConcurrentRefresh)
+}
+
+// testConcurrentRefresh starts several refreshes of the same saved refresh
+// token against a server that rotates it and rejects reuse. Only the first
+// refresh may reach the server; the others must pick up its result.
+func testConcurrentRefresh(t *testing.T) {
+	origServerURL, origClientID := serverURL, clientID
+	defer func() {
+		serverURL, clientID = origServerURL, origClientID
+	}()
+
+	var (
+		mu       sync.Mutex
+		current  = "refresh-0"
+		requests atomic.Int32
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("refresh_token") != current {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		n := requests.Load()
+		current = fmt.Sprintf("refresh-%d", n)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  fmt.Sprintf("new-access-token-%d", n),
+			"refresh_token": current,
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	}))
+	defer server.Close()
+
+	serverURL = server.URL
+	clientID = "client-refresh"
+	if err := saveTokens(&TokenStorage{
+		AccessToken:  "access-0",
+		RefreshToken: "refresh-0",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(-time.Minute),
+	}); err != nil {
+		t.Fatalf("Failed to seed tokens: %v", err)
+	}
+
+	const refreshers = 10
+	results := make([]*TokenStorage, refreshers)
+	var wg sync.WaitGroup
+	for i := range refreshers {
+		wg.Go(func() {
+			storage, err := refreshAccessToken(
+				context.Background(), "refresh-0", tui.NoopDisplayer{},
+			)
+			if err != nil {
+				t.Errorf("Refresher %d: %v", i, err)
+				return
+			}
+			results[i] = storage
+		})
+	}
+	wg.Wait()
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Expected 1 refresh request, got %d", n)
+	}
+	for i, storage := range results {
+		if storage != nil && storage.AccessToken != "new-access-token-1" {
+			t.Errorf("Refresher %d: expected new-access-token-1, got %s", i, storage.AccessToken)
+		}
+	}
+
+	saved, err := loadTokens()
+	if err != nil {
+		t.Fatalf("Failed to load tokens: %v", err)
+	}
+	if saved.RefreshToken != "refresh-1" {
+		t.Errorf("Expected saved refresh token refresh-1, got %s", saved.RefreshToken)
 	}
 }
 
@@ -154,15 +237,68 @@ func TestSaveTokens_PreservesOtherClients(t *testing.T) {
 		t.Errorf("Expected 2 clients, got %d", len(storageMap.Tokens))
 	}
 
-	if token, ok := storageMap.Tokens["client-1"]; !ok || token.AccessToken != "token-1" {
+	token, ok := storageMap.Tokens[authgate.TokenKey(serverURL, "client-1")]
+	if !ok || token.AccessToken != "token-1" {
 		t.Errorf("Client 1 token was not preserved")
 	}
 
-	if token, ok := storageMap.Tokens["client-2"]; !ok || token.AccessToken != "token-2" {
+	token, ok = storageMap.Tokens[authgate.TokenKey(serverURL, "client-2")]
+	if !ok || token.AccessToken != "token-2" {
 		t.Errorf("Client 2 token was not saved correctly")
 	}
 }
 
+func TestDeleteTokens(t *testing.T) {
+	tempDir := t.TempDir()
+	tokenFile = filepath.Join(tempDir, "tokens.json")
+
+	for _, id := range []string{"client-1", "client-2"} {
+		if err := saveTokens(&TokenStorage{
+			AccessToken:  "token-" + id,
+			RefreshToken: "refresh-" + id,
+			TokenType:    "Bearer",
+			ExpiresAt:    time.Now().Add(1 * time.Hour),
+			ClientID:     id,
+		}); err != nil {
+			t.Fatalf("Failed to save %s: %v", id, err)
+		}
+	}
+
+	clientID = "client-1"
+	removed, err := deleteTokens()
+	if err != nil {
+		t.Fatalf("deleteTokens() error = %v", err)
+	}
+	if !removed {
+		t.Error("deleteTokens() reported nothing removed for existing client")
+	}
+
+	removed, err = deleteTokens()
+	if err != nil {
+		t.Fatalf("second deleteTokens() error = %v", err)
+	}
+	if removed {
+		t.Error("second deleteTokens() reported a removal")
+	}
+
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		t.Fatalf("Failed to read token file: %v", err)
+	}
+
+	var storageMap TokenStorageMap
+	if err := json.Unmarshal(data, &storageMap); err != nil {
+		t.Fatalf("Failed to parse token file: %v", err)
+	}
+
+	if _, ok := storageMap.Tokens[authgate.TokenKey(serverURL, "client-1")]; ok {
+		t.Error("client-1 token still present after delete")
+	}
+	if _, ok := storageMap.Tokens[authgate.TokenKey(serverURL, "client-2")]; !ok {
+		t.Error("client-2 token was not preserved")
+	}
+}
+
 func BenchmarkSaveTokens_SingleClient(b *testing.B) {
 	tempDir := b.TempDir()
 	tokenFile = filepath.Join(tempDir, "tokens.json")
@@ -208,94 +344,6 @@ func BenchmarkSaveTokens_ParallelWrites(b *testing.B) {
 	})
 }
 
-func TestValidateTokenResponse(t *testing.T) {
-	tests := []struct {
-		name        string
-		accessToken string
-		tokenType   string
-		expiresIn   int
-		wantErr     bool
-		errContains string
-	}{
-		{
-			name:        "valid token response",
-			accessToken: "valid-access-token-123456",
-			tokenType:   "Bearer",
-			expiresIn:   3600,
-			wantErr:     false,
-		},
-		{
-			name:        "valid token with empty type (optional field)",
-			accessToken: "valid-access-token-123456",
-			tokenType:   "",
-			expiresIn:   3600,
-			wantErr:     false,
-		},
-		{
-			name:        "empty access token",
-			accessToken: "",
-			tokenType:   "Bearer",
-			expiresIn:   3600,
-			wantErr:     true,
-			errContains: "access_token is empty",
-		},
-		{
-			name:        "access token too short",
-			accessToken: "short",
-			tokenType:   "Bearer",
-			expiresIn:   3600,
-			wantErr:     true,
-			errContains: "access_token is too short",
-		},
-		{
-			name:        "zero expires_in",
-			accessToken: "valid-access-token-123456",
-			tokenType:   "Bearer",
-			expiresIn:   0,
-			wantErr:     true,
-			errContains: "expires_in must be positive",
-		},
-		{
-			name:        "negative expires_in",
-			accessToken: "valid-access-token-123456",
-			tokenType:   "Bearer",
-			expiresIn:   -3600,
-			wantErr:     true,
-			errContains: "expires_in must be positive",
-		},
-		{
-			name:        "invalid token type",
-			accessToken: "valid-access-token-123456",
-			tokenType:   "Basic",
-			expiresIn:   3600,
-			wantErr:     true,
-			errContains: "unexpected token_type",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := validateTokenResponse(tt.accessToken, tt.tokenType, tt.expiresIn)
-
-			if tt.wantErr {
-				if err == nil {
-					t.Errorf("validateTokenResponse() expected error but got nil")
-					return
-				}
-				if tt.errContains != "" && !contains(err.Error(), tt.errContains) {
-					t.Errorf(
-						"validateTokenResponse() error = %v, want error containing %q",
-						err,
-						tt.errContains,
-					)
-				}
-			} else if err != nil {
-				t.Errorf("validateTokenResponse() unexpected error = %v", err)
-			}
-		})
-	}
-}
-
 // contains checks if string s contains substr
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
@@ -434,7 +482,7 @@ func TestRefreshAccessToken_RotationMode(t *testing.T) {
 				t.Fatalf("Failed to parse token file: %v", err)
 			}
 
-			savedToken, ok := storageMap.Tokens[clientID]
+			savedToken, ok := storageMap.Tokens[authgate.TokenKey(serverURL, clientID)]
 			if !ok {
 				t.Fatalf("Token not found in file for client %s", clientID)
 			}
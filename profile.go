@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// profile holds the settings of one named profile in the config file. Empty
+// fields fall through to the built-in defaults.
+type profile struct {
+	ServerURL    string `toml:"server_url"`
+	ClientID     string `toml:"client_id"`
+	TokenFile    string `toml:"token_file"`
+	TokenStore   string `toml:"token_store"`
+	TokenKeyFile string `toml:"token_key_file"`
+	Scope        string `toml:"scope"`
+}
+
+// configFile is the layout of config.toml:
+//
+//	default_profile = "staging"
+//
+//	[profiles.staging]
+//	server_url = "https://auth.staging.example.com"
+//	client_id  = "..."
+//	scope      = "read"
+//
+//	[registries]
+//	"registry.example.com" = "staging" # a profile name or a client ID
+type configFile struct {
+	DefaultProfile string             `toml:"default_profile"`
+	Profiles       map[string]profile `toml:"profiles"`
+	Registries     map[string]string  `toml:"registries"`
+}
+
+// configFilePath returns $XDG_CONFIG_HOME/authgate/config.toml, falling back
+// to the platform's user config directory when XDG_CONFIG_HOME is unset.
+func configFilePath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		var err error
+		if dir, err = os.UserConfigDir(); err != nil {
+			return ""
+		}
+	}
+	return filepath.Join(dir, "authgate", "config.toml")
+}
+
+// loadConfigFile reads the config file at path. A missing file yields an
+// empty configuration; unknown keys are reported so typos do not go unnoticed.
+func loadConfigFile(path string) (*configFile, error) {
+	cfg := &configFile{}
+	if path == "" {
+		return cfg, nil
+	}
+	md, err := toml.DecodeFile(path, cfg)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown key %q in %s", undecoded[0].String(), path)
+	}
+	return cfg, nil
+}
+
+// selectProfile returns the profile called name, or the file's default
+// profile when name is empty. It returns a zero profile and an empty name
+// when neither is set.
+func (cfg *configFile) selectProfile(name string) (profile, string, error) {
+	if name == "" {
+		name = cfg.DefaultProfile
+	}
+	if name == "" {
+		return profile{}, "", nil
+	}
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return profile{}, "", fmt.Errorf("profile %q not found in %s", name, configFilePath())
+	}
+	return p, name, nil
+}
+
+// registryTarget returns the profile name or client ID that the [registries]
+// table maps host to. Keys are compared as registry hosts, so
+// "https://Registry.example.com/" matches registry.example.com.
+func (cfg *configFile) registryTarget(host string) (string, bool) {
+	for key, target := range cfg.Registries {
+		if registryHost(key) == host {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// applyProfile applies the fields p sets to the current configuration, for
+// commands that pick a profile per request. Values given by flag or
+// environment variable still take precedence, as in initConfig.
+func applyProfile(p profile) error {
+	server := getConfig(*flagServerURL, "SERVER_URL", p.ServerURL, serverURL)
+	if server != serverURL {
+		if err := validateServerURL(server); err != nil {
+			return fmt.Errorf("invalid server_url: %w", err)
+		}
+		serverURL = server
+	}
+	store := getConfig(*flagTokenStore, "TOKEN_STORE", p.TokenStore, tokenStore)
+	if store != tokenStore {
+		if !slices.Contains(tokenStores, store) {
+			return fmt.Errorf("invalid token_store %q", store)
+		}
+		tokenStore = store
+	}
+	clientID = getConfig(*flagClientID, "CLIENT_ID", p.ClientID, clientID)
+	tokenFile = getConfig(*flagTokenFile, "TOKEN_FILE", p.TokenFile, tokenFile)
+	tokenKeyFile = getConfig(*flagTokenKeyFile, "TOKEN_KEY_FILE", p.TokenKeyFile, tokenKeyFile)
+	scope = getConfig(*flagScope, "SCOPE", p.Scope, scope)
+	return nil
+}
+
+// profileNames returns the profile names in sorted order.
+func (cfg *configFile) profileNames() []string {
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// cmdProfiles lists the profiles in the config file or shows one of them.
+func cmdProfiles(_ context.Context, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: profiles list | profiles show [name]")
+		return exitUsage
+	}
+
+	cfg, err := loadConfigFile(configFilePath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	switch args[0] {
+	case "list":
+		if !noArgs("profiles list", args[1:]) {
+			return exitUsage
+		}
+		if len(cfg.Profiles) == 0 {
+			fmt.Fprintf(os.Stderr, "No profiles defined in %s\n", configFilePath())
+			return exitOK
+		}
+		for _, name := range cfg.profileNames() {
+			marker := " "
+			if name == profileName {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, name)
+		}
+		return exitOK
+
+	case "show":
+		if len(args) > 2 {
+			fmt.Fprintln(os.Stderr, "Usage: profiles show [name]")
+			return exitUsage
+		}
+		name := profileName
+		if len(args) == 2 {
+			name = args[1]
+		}
+		if name == "" {
+			fmt.Fprintln(os.Stderr, "Error: no active profile; pass a profile name")
+			return exitUsage
+		}
+		p, ok := cfg.Profiles[name]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: profile %q not found in %s\n", name, configFilePath())
+			return exitError
+		}
+		fmt.Printf("Profile:     %s\n", name)
+		fmt.Printf("Server URL:  %s\n", orUnset(p.ServerURL))
+		fmt.Printf("Client ID:   %s\n", orUnset(p.ClientID))
+		fmt.Printf("Token File:  %s\n", orUnset(p.TokenFile))
+		fmt.Printf("Token Store: %s\n", orUnset(p.TokenStore))
+		fmt.Printf("Key File:    %s\n", orUnset(p.TokenKeyFile))
+		fmt.Printf("Scope:       %s\n", orUnset(p.Scope))
+		return exitOK
+
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown profiles subcommand %q\n", args[0])
+		return exitUsage
+	}
+}
+
+// orUnset returns s, or a placeholder when s is empty.
+func orUnset(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "(not set)"
+	}
+	return s
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `
+default_profile = "staging"
+
+[profiles.staging]
+server_url = "https://auth.staging.example.com"
+client_id  = "staging-client"
+scope      = "read"
+
+[profiles.production]
+server_url = "https://auth.example.com"
+client_id  = "prod-client"
+token_file = "/tmp/prod-tokens.json"
+`)
+
+	cfg, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatalf("loadConfigFile() error = %v", err)
+	}
+	got, want := cfg.profileNames(), []string{"production", "staging"}
+	if !slices.Equal(got, want) {
+		t.Errorf("profileNames() = %v, want %v", got, want)
+	}
+
+	p, name, err := cfg.selectProfile("")
+	if err != nil {
+		t.Fatalf("selectProfile(\"\") error = %v", err)
+	}
+	if name != "staging" || p.ClientID != "staging-client" || p.Scope != "read" {
+		t.Errorf("selectProfile(\"\") = %+v, %q; want staging profile", p, name)
+	}
+
+	p, name, err = cfg.selectProfile("production")
+	if err != nil {
+		t.Fatalf("selectProfile(production) error = %v", err)
+	}
+	if name != "production" || p.TokenFile != "/tmp/prod-tokens.json" {
+		t.Errorf("selectProfile(production) = %+v, %q; want production profile", p, name)
+	}
+
+	if _, _, err := cfg.selectProfile("missing"); err == nil {
+		t.Error("selectProfile(missing) expected error, got nil")
+	}
+}
+
+func TestLoadConfigFile_Missing(t *testing.T) {
+	cfg, err := loadConfigFile(filepath.Join(t.TempDir(), "config.toml"))
+	if err != nil {
+		t.Fatalf("loadConfigFile() error = %v", err)
+	}
+	p, name, err := cfg.selectProfile("")
+	if err != nil || name != "" || p != (profile{}) {
+		t.Errorf("selectProfile(\"\") = %+v, %q, %v; want zero profile", p, name, err)
+	}
+}
+
+func TestLoadConfigFile_UnknownKey(t *testing.T) {
+	path := writeConfigFile(t, `
+[profiles.staging]
+client_di = "typo"
+`)
+	_, err := loadConfigFile(path)
+	if err == nil || !strings.Contains(err.Error(), "client_di") {
+		t.Errorf("loadConfigFile() error = %v, want unknown key error", err)
+	}
+}
+
+func TestGetConfig_Precedence(t *testing.T) {
+	t.Setenv("AUTHGATE_TEST_KEY", "")
+
+	if got := getConfig("", "AUTHGATE_TEST_KEY", "", "default"); got != "default" {
+		t.Errorf("default: got %q", got)
+	}
+	if got := getConfig("", "AUTHGATE_TEST_KEY", "profile", "default"); got != "profile" {
+		t.Errorf("profile over default: got %q", got)
+	}
+
+	t.Setenv("AUTHGATE_TEST_KEY", "env")
+	if got := getConfig("", "AUTHGATE_TEST_KEY", "profile", "default"); got != "env" {
+		t.Errorf("env over profile: got %q", got)
+	}
+	if got := getConfig("flag", "AUTHGATE_TEST_KEY", "profile", "default"); got != "flag" {
+		t.Errorf("flag over env: got %q", got)
+	}
+}
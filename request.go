@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-authgate/device-cli/tui"
+)
+
+// apiRequestTimeout bounds each attempt of a request made by the request command.
+const apiRequestTimeout = 30 * time.Second
+
+// headerFlags collects repeated -H "Name: value" flags.
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	*h = append(*h, value)
+	return nil
+}
+
+// cmdRequest sends an authenticated HTTP request, like a minimal curl that
+// handles AuthGate tokens, and writes the response body to stdout.
+func cmdRequest(ctx context.Context, args []string) int {
+	var headers headerFlags
+	flags := flag.NewFlagSet("request", flag.ContinueOnError)
+	flags.Var(&headers, "H", `Request header "Name: value" (repeatable)`)
+	data := flags.String("d", "", "Request body; @file reads a file and @- reads stdin")
+	pretty := flags.Bool("pretty", false, "Pretty-print JSON responses")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: request [flags] <METHOD> <path-or-url>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	method := strings.ToUpper(flags.Arg(0))
+	target := resolveRequestURL(flags.Arg(1))
+
+	header, err := parseHeaders(headers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitUsage
+	}
+	body, err := readRequestBody(*data, os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if body != nil && header.Get("Content-Type") == "" && json.Valid(body) {
+		header.Set("Content-Type", "application/json")
+	}
+
+	storage, err := freshToken(ctx, refreshAhead)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCodeFor(err)
+	}
+
+	d := tui.NewPlainDisplayer(os.Stderr)
+	resp, err := doWithAutoRefresh(
+		ctx, storage, method, target, body, header, apiRequestTimeout, d,
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCodeFor(err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to read response: %v\n", err)
+		return exitCodeFor(err)
+	}
+
+	if *pretty {
+		respBody = prettyJSON(respBody)
+	}
+	_, _ = os.Stdout.Write(respBody)
+	if len(respBody) > 0 && respBody[len(respBody)-1] != '\n' {
+		fmt.Println()
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		fmt.Fprintf(os.Stderr, "Error: server returned status %s\n", resp.Status)
+		return exitError
+	}
+	return exitOK
+}
+
+// resolveRequestURL returns target unchanged if it is an absolute http(s) URL,
+// and otherwise treats it as a path on the configured server.
+func resolveRequestURL(target string) string {
+	lower := strings.ToLower(target)
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		return target
+	}
+	return strings.TrimRight(serverURL, "/") + "/" + strings.TrimLeft(target, "/")
+}
+
+// parseHeaders converts "Name: value" strings into an http.Header.
+func parseHeaders(values []string) (http.Header, error) {
+	header := make(http.Header)
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header %q, expected \"Name: value\"", v)
+		}
+		header.Add(name, strings.TrimSpace(value))
+	}
+	return header, nil
+}
+
+// readRequestBody interprets the -d flag: "" means no body, "@-" reads stdin,
+// "@path" reads a file, and anything else is sent literally.
+func readRequestBody(data string, stdin io.Reader) ([]byte, error) {
+	switch {
+	case data == "":
+		return nil, nil
+	case data == "@-":
+		body, err := io.ReadAll(stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read body from stdin: %w", err)
+		}
+		return body, nil
+	case strings.HasPrefix(data, "@"):
+		body, err := os.ReadFile(data[1:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read body file: %w", err)
+		}
+		return body, nil
+	default:
+		return []byte(data), nil
+	}
+}
+
+// prettyJSON indents body if it is valid JSON and returns it unchanged otherwise.
+func prettyJSON(body []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, body, "", "  "); err != nil {
+		return body
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/device-cli/authgate"
+	"github.com/go-authgate/device-cli/tui"
+)
+
+func TestResolveRequestURL(t *testing.T) {
+	origServerURL := serverURL
+	defer func() { serverURL = origServerURL }()
+	serverURL = "https://auth.example.com/"
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/api/me", "https://auth.example.com/api/me"},
+		{"api/me", "https://auth.example.com/api/me"},
+		{"https://api.example.com/v1/items", "https://api.example.com/v1/items"},
+		{"HTTP://api.example.com/", "HTTP://api.example.com/"},
+	}
+
+	for _, tt := range tests {
+		if got := resolveRequestURL(tt.target); got != tt.want {
+			t.Errorf("resolveRequestURL(%q) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	header, err := parseHeaders([]string{"Accept: application/json", "X-Trace:abc"})
+	if err != nil {
+		t.Fatalf("parseHeaders() error = %v", err)
+	}
+	if got := header.Get("Accept"); got != "application/json" {
+		t.Errorf("Accept = %q, want application/json", got)
+	}
+	if got := header.Get("X-Trace"); got != "abc" {
+		t.Errorf("X-Trace = %q, want abc", got)
+	}
+
+	if _, err := parseHeaders([]string{"no-colon"}); err == nil {
+		t.Error("parseHeaders() expected error for header without colon")
+	}
+}
+
+func TestReadRequestBody(t *testing.T) {
+	bodyFile := filepath.Join(t.TempDir(), "body.json")
+	if err := os.WriteFile(bodyFile, []byte(`{"from":"file"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"literal", `{"from":"flag"}`, `{"from":"flag"}`},
+		{"stdin", "@-", `{"from":"stdin"}`},
+		{"file", "@" + bodyFile, `{"from":"file"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := readRequestBody(tt.data, strings.NewReader(`{"from":"stdin"}`))
+			if err != nil {
+				t.Fatalf("readRequestBody() error = %v", err)
+			}
+			if string(body) != tt.want {
+				t.Errorf("body = %s, want %s", body, tt.want)
+			}
+		})
+	}
+
+	if body, err := readRequestBody("", nil); err != nil || body != nil {
+		t.Errorf("readRequestBody(\"\") = %q, %v; want nil, nil", body, err)
+	}
+}
+
+func TestDoWithAutoRefresh_ReplaysBodyAfterRefresh(t *testing.T) {
+	origServerURL := serverURL
+	origClientID := clientID
+	origTokenFile := tokenFile
+	defer func() {
+		serverURL = origServerURL
+		clientID = origClientID
+		tokenFile = origTokenFile
+	}()
+
+	tokenFile = filepath.Join(t.TempDir(), "tokens.json")
+	clientID = "test-client-request"
+
+	var refreshCalls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/token":
+			refreshCalls.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"access_token":  "refreshed-access-token",
+				"refresh_token": "refreshed-refresh-token",
+				"token_type":    "Bearer",
+				"expires_in":    3600,
+				"scope":         "read",
+			})
+		case "/api/items":
+			if r.Header.Get("Authorization") != "Bearer refreshed-access-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(body)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	serverURL = server.URL
+
+	storage := &TokenStorage{
+		AccessToken:  "stale-access-token",
+		RefreshToken: "stale-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(time.Hour),
+		ClientID:     clientID,
+	}
+	if err := saveTokens(storage); err != nil {
+		t.Fatalf("saveTokens() error = %v", err)
+	}
+
+	resp, err := doWithAutoRefresh(
+		context.Background(),
+		storage,
+		http.MethodPost,
+		server.URL+"/api/items",
+		[]byte(`{"name":"widget"}`),
+		http.Header{"Content-Type": {"application/json"}},
+		apiRequestTimeout,
+		tui.NoopDisplayer{},
+	)
+	if err != nil {
+		t.Fatalf("doWithAutoRefresh() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if string(body) != `{"name":"widget"}` {
+		t.Errorf("replayed body = %s, want original request body", body)
+	}
+	if got := refreshCalls.Load(); got != 1 {
+		t.Errorf("refresh calls = %d, want 1", got)
+	}
+	if storage.AccessToken != "refreshed-access-token" {
+		t.Errorf("storage.AccessToken = %s, want refreshed-access-token", storage.AccessToken)
+	}
+	if storage.Scope != "read" {
+		t.Errorf("storage.Scope = %q, want the refreshed scope read", storage.Scope)
+	}
+}
+
+func TestDoWithAutoRefresh_AsksAgent(t *testing.T) {
+	origServerURL, origClientID := serverURL, clientID
+	origTokenFile, origAgentSocket := tokenFile, agentSocket
+	defer func() {
+		serverURL, clientID = origServerURL, origClientID
+		tokenFile, agentSocket = origTokenFile, origAgentSocket
+	}()
+	tokenFile = filepath.Join(t.TempDir(), "tokens.json")
+	clientID = "test-client-request-agent"
+
+	var refreshCalls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/token":
+			refreshCalls.Add(1)
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		case "/api/items":
+			if r.Header.Get("Authorization") != "Bearer agent-access-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	serverURL = server.URL
+
+	// The agent has replaced the token it served earlier.
+	agentClient := newClient()
+	agentClient.Store = &authgate.MemoryStore{}
+	if err := agentClient.SaveTokens(&TokenStorage{
+		AccessToken:  "agent-access-token",
+		RefreshToken: "agent-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("SaveTokens() error = %v", err)
+	}
+	agentSocket = filepath.Join(t.TempDir(), "agent", "agent.sock")
+	l, err := authgate.ListenAgent(agentSocket)
+	if err != nil {
+		t.Fatalf("ListenAgent() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- (&authgate.Agent{Client: agentClient}).Serve(ctx, l) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Tokens served by the agent carry no refresh token.
+	storage := &TokenStorage{
+		AccessToken: "rejected-agent-token",
+		TokenType:   "Bearer",
+		ExpiresAt:   time.Now().Add(time.Hour),
+		ClientID:    clientID,
+	}
+	resp, err := doWithAutoRefresh(
+		context.Background(), storage, http.MethodGet, server.URL+"/api/items",
+		nil, nil, apiRequestTimeout, tui.NoopDisplayer{},
+	)
+	if err != nil {
+		t.Fatalf("doWithAutoRefresh() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || storage.AccessToken != "agent-access-token" {
+		t.Errorf("status %d with token %q, want 200 with the agent's token",
+			resp.StatusCode, storage.AccessToken)
+	}
+	if got := refreshCalls.Load(); got != 0 {
+		t.Errorf("refresh calls = %d, want 0", got)
+	}
+}
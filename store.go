@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/x/term"
+	"github.com/go-authgate/device-cli/authgate"
+)
+
+// Token store backends selectable with -token-store
+const (
+	tokenStoreFile      = "file"
+	tokenStoreEncrypted = "encrypted"
+	tokenStoreKeyring   = "keyring"
+)
+
+// tokenStores lists the valid -token-store values.
+var tokenStores = []string{tokenStoreFile, tokenStoreEncrypted, tokenStoreKeyring}
+
+// envPassphrase supplies the passphrase of an encrypted token file.
+const envPassphrase = "AUTHGATE_TOKEN_PASSPHRASE"
+
+// newTokenStore returns the token store selected with -token-store.
+func newTokenStore() authgate.TokenStore {
+	return tokenStoreFor(tokenStore)
+}
+
+// tokenStoreFor returns the token store called name. The keyring store shares
+// the token file's lock so that updates from several processes are still
+// serialized.
+func tokenStoreFor(name string) authgate.TokenStore {
+	switch name {
+	case tokenStoreKeyring:
+		return &authgate.SecretServiceStore{LockPath: tokenFile, LockTimeout: lockTimeout}
+	case tokenStoreEncrypted:
+		return &authgate.FileStore{Path: tokenFile, Key: tokenFileKey(), LockTimeout: lockTimeout}
+	default:
+		return &authgate.FileStore{Path: tokenFile, LockTimeout: lockTimeout}
+	}
+}
+
+// tokenFileKey returns the key of the encrypted token file. It is shared by
+// all stores so the passphrase is asked for at most once per run.
+var tokenFileKey = sync.OnceValue(func() *authgate.FileKey {
+	return &authgate.FileKey{KeyFile: tokenKeyFile, Passphrase: readPassphrase}
+})
+
+// readPassphrase returns the token file passphrase from the environment, or
+// prompts for it when stdin is a terminal.
+func readPassphrase() ([]byte, error) {
+	if passphrase := os.Getenv(envPassphrase); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return nil, fmt.Errorf("set %s or -token-key-file to unlock the token file", envPassphrase)
+	}
+	fmt.Fprint(os.Stderr, "Token file passphrase: ")
+	passphrase, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	return passphrase, err
+}
+
+// cmdMigrateStore copies every saved token from the current token store to
+// the one named by -to. Tokens are removed from the old store unless both
+// stores use the token file, in which case the file is rewritten in place.
+func cmdMigrateStore(_ context.Context, args []string) int {
+	flags := flag.NewFlagSet("migrate-store", flag.ContinueOnError)
+	to := flags.String("to", "", "Token store to move tokens to: "+strings.Join(tokenStores, ", "))
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if !noArgs("migrate-store", flags.Args()) {
+		return exitUsage
+	}
+	if !slices.Contains(tokenStores, *to) {
+		fmt.Fprintf(os.Stderr, "Error: -to must be one of: %s\n", strings.Join(tokenStores, ", "))
+		return exitUsage
+	}
+	if *to == tokenStore {
+		fmt.Fprintf(os.Stderr, "Error: tokens are already kept in the %s store\n", tokenStore)
+		return exitUsage
+	}
+
+	// file and encrypted share the token file, so only moves to or from the
+	// keyring leave a copy behind to clean up.
+	clearSource := (tokenStore == tokenStoreKeyring) != (*to == tokenStoreKeyring)
+	src, dst := newTokenStore(), tokenStoreFor(*to)
+	if tokenStore == tokenStoreEncrypted && *to == tokenStoreFile {
+		// The shared token file stays sealed until dst rewrites it.
+		dst.(*authgate.FileStore).DecryptKey = tokenFileKey()
+	}
+	moved, err := migrateTokens(src, dst, clearSource)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	if moved == 0 {
+		fmt.Fprintf(os.Stderr, "No saved tokens in %s\n", src)
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "Migrated %d token entries from %s to %s\n", moved, src, dst)
+	return exitOK
+}
+
+// migrateTokens copies all entries of src into dst, then removes them from
+// src when clearSource is set, and returns the number of entries copied.
+// Entries are only removed once dst has saved them.
+func migrateTokens(src, dst authgate.TokenStore, clearSource bool) (int, error) {
+	tokens, err := src.Load()
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && len(tokens) == 0) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", src, err)
+	}
+
+	err = dst.Update(func(saved map[string]*TokenStorage) (bool, error) {
+		maps.Copy(saved, tokens)
+		return true, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+
+	if clearSource {
+		err = src.Update(func(saved map[string]*TokenStorage) (bool, error) {
+			for key := range tokens {
+				delete(saved, key)
+			}
+			return true, nil
+		})
+		if err != nil {
+			return len(tokens), fmt.Errorf(
+				"tokens were copied but not removed from %s: %w", src, err,
+			)
+		}
+	}
+	return len(tokens), nil
+}
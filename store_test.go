@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-authgate/device-cli/authgate"
+)
+
+func TestMigrateTokens_FileToEncrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	plain := &authgate.FileStore{Path: path}
+	err := plain.Update(func(tokens map[string]*TokenStorage) (bool, error) {
+		tokens[authgate.TokenKey(serverURL, "client-1")] = &TokenStorage{
+			AccessToken:  "access-1",
+			RefreshToken: "refresh-1",
+			ExpiresAt:    time.Now().Add(time.Hour),
+			ClientID:     "client-1",
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to seed token file: %v", err)
+	}
+
+	key := &authgate.FileKey{Passphrase: func() ([]byte, error) { return []byte("secret"), nil }}
+	encrypted := &authgate.FileStore{Path: path, Key: key}
+	moved, err := migrateTokens(plain, encrypted, false)
+	if err != nil || moved != 1 {
+		t.Fatalf("migrateTokens() = %d, %v; want 1, nil", moved, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read token file: %v", err)
+	}
+	if bytes.Contains(data, []byte("refresh-1")) {
+		t.Error("token file still holds a plaintext refresh token")
+	}
+	tokens, err := encrypted.Load()
+	if err != nil {
+		t.Fatalf("Load() of migrated file error = %v", err)
+	}
+	got := tokens[authgate.TokenKey(serverURL, "client-1")]
+	if got == nil || got.RefreshToken != "refresh-1" {
+		t.Errorf("migrated entry = %+v, want refresh-1", got)
+	}
+}
+
+func TestMigrateTokens_EncryptedToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	key := &authgate.FileKey{Passphrase: func() ([]byte, error) { return []byte("secret"), nil }}
+	encrypted := &authgate.FileStore{Path: path, Key: key}
+	err := encrypted.Update(func(tokens map[string]*TokenStorage) (bool, error) {
+		tokens[authgate.TokenKey(serverURL, "client-1")] = &TokenStorage{
+			AccessToken:  "access-1",
+			RefreshToken: "refresh-1",
+			ExpiresAt:    time.Now().Add(time.Hour),
+			ClientID:     "client-1",
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to seed token file: %v", err)
+	}
+
+	plain := &authgate.FileStore{Path: path, DecryptKey: key}
+	moved, err := migrateTokens(encrypted, plain, false)
+	if err != nil || moved != 1 {
+		t.Fatalf("migrateTokens() = %d, %v; want 1, nil", moved, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read token file: %v", err)
+	}
+	if !bytes.Contains(data, []byte("refresh-1")) {
+		t.Error("token file is still encrypted")
+	}
+	tokens, err := (&authgate.FileStore{Path: path}).Load()
+	if err != nil {
+		t.Fatalf("Load() of migrated file without a key error = %v", err)
+	}
+	got := tokens[authgate.TokenKey(serverURL, "client-1")]
+	if got == nil || got.RefreshToken != "refresh-1" {
+		t.Errorf("migrated entry = %+v, want refresh-1", got)
+	}
+}
+
+func TestMigrateTokens_ClearsSource(t *testing.T) {
+	src := &authgate.MemoryStore{}
+	err := src.Update(func(tokens map[string]*TokenStorage) (bool, error) {
+		tokens["a"] = &TokenStorage{AccessToken: "access-a"}
+		tokens["b"] = &TokenStorage{AccessToken: "access-b"}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to seed source: %v", err)
+	}
+	dst := &authgate.FileStore{Path: filepath.Join(t.TempDir(), "tokens.json")}
+
+	moved, err := migrateTokens(src, dst, true)
+	if err != nil || moved != 2 {
+		t.Fatalf("migrateTokens() = %d, %v; want 2, nil", moved, err)
+	}
+	if tokens, _ := src.Load(); len(tokens) != 0 {
+		t.Errorf("source still holds %d entries", len(tokens))
+	}
+	if tokens, err := dst.Load(); err != nil || len(tokens) != 2 {
+		t.Errorf("destination holds %d entries (err %v), want 2", len(tokens), err)
+	}
+
+	moved, err = migrateTokens(src, dst, true)
+	if err != nil || moved != 0 {
+		t.Errorf("second migrateTokens() = %d, %v; want 0, nil", moved, err)
+	}
+}
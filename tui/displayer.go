@@ -3,6 +3,8 @@ package tui
 import (
 	"fmt"
 	"io"
+	"strconv"
+	"strings"
 	"time"
 
 	tea "charm.land/bubbletea/v2"
@@ -15,6 +17,7 @@ type Displayer interface {
 	TokenValid()
 	TokenExpired()
 	TokensNotFound()
+	ScopeMissing(missing []string)
 	Refreshing()
 	RefreshOK()
 	RefreshFailed(err error)
@@ -24,9 +27,11 @@ type Displayer interface {
 	AuthSuccess()
 	TokenSaved(path string)
 	TokenSaveFailed(err error)
+	IDTokenRejected(err error)
 	Verifying()
 	VerifyOK(body string)
 	VerifyFailed(err error)
+	Introspected(info Introspection)
 	APICallOK()
 	APICallFailed(err error)
 	AccessTokenRejected()
@@ -36,6 +41,43 @@ type Displayer interface {
 	Fatal(err error)
 }
 
+// Introspection is the state of a token as reported by the server's
+// introspection endpoint.
+type Introspection struct {
+	Active    bool
+	Scope     string
+	ClientID  string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+}
+
+// Rows returns the introspected fields as label and value pairs, in the
+// order they are displayed. Fields the server did not report are shown as "-".
+func (i Introspection) Rows() [][2]string {
+	orDash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	expires := "-"
+	if !i.ExpiresAt.IsZero() {
+		expires = i.ExpiresAt.Local().Format(time.RFC3339)
+		if remaining := time.Until(i.ExpiresAt).Round(time.Second); remaining > 0 {
+			expires += " (in " + remaining.String() + ")"
+		}
+	}
+	return [][2]string{
+		{"Active", strconv.FormatBool(i.Active)},
+		{"Scope", orDash(i.Scope)},
+		{"Client ID", orDash(i.ClientID)},
+		{"Subject", orDash(i.Subject)},
+		{"Audience", orDash(strings.Join(i.Audience, ", "))},
+		{"Expires At", expires},
+	}
+}
+
 // PlainDisplayer writes plain text output to w, reproducing the original CLI output.
 // Used when stdout is not a TTY (pipes, CI, SSH without pty).
 type PlainDisplayer struct {
@@ -68,6 +110,14 @@ func (p *PlainDisplayer) TokensNotFound() {
 	fmt.Fprintln(p.w, "No existing tokens found, starting device flow...")
 }
 
+func (p *PlainDisplayer) ScopeMissing(missing []string) {
+	fmt.Fprintf(
+		p.w,
+		"Saved token lacks scope %q, starting device flow...\n",
+		strings.Join(missing, " "),
+	)
+}
+
 func (p *PlainDisplayer) Refreshing() {
 	fmt.Fprintln(p.w, "Refreshing access token...")
 }
@@ -114,6 +164,10 @@ func (p *PlainDisplayer) TokenSaveFailed(err error) {
 	fmt.Fprintf(p.w, "Warning: Failed to save tokens: %v\n", err)
 }
 
+func (p *PlainDisplayer) IDTokenRejected(err error) {
+	fmt.Fprintf(p.w, "Warning: ID token not saved: %v\n", err)
+}
+
 func (p *PlainDisplayer) Verifying() {
 	fmt.Fprintln(p.w, "\nVerifying token...")
 }
@@ -129,6 +183,13 @@ func (p *PlainDisplayer) VerifyFailed(err error) {
 	fmt.Fprintf(p.w, "Token verification failed: %v\n", err)
 }
 
+func (p *PlainDisplayer) Introspected(info Introspection) {
+	fmt.Fprintln(p.w, "Token Introspection:")
+	for _, row := range info.Rows() {
+		fmt.Fprintf(p.w, "  %-11s %s\n", row[0], row[1])
+	}
+}
+
 func (p *PlainDisplayer) APICallOK() {
 	fmt.Fprintln(p.w, "API call successful!")
 }
@@ -170,6 +231,7 @@ func (NoopDisplayer) TokensFound()                                {}
 func (NoopDisplayer) TokenValid()                                 {}
 func (NoopDisplayer) TokenExpired()                               {}
 func (NoopDisplayer) TokensNotFound()                             {}
+func (NoopDisplayer) ScopeMissing(_ []string)                     {}
 func (NoopDisplayer) Refreshing()                                 {}
 func (NoopDisplayer) RefreshOK()                                  {}
 func (NoopDisplayer) RefreshFailed(_ error)                       {}
@@ -179,9 +241,11 @@ func (NoopDisplayer) PollSlowDown(_ time.Duration)                {}
 func (NoopDisplayer) AuthSuccess()                                {}
 func (NoopDisplayer) TokenSaved(_ string)                         {}
 func (NoopDisplayer) TokenSaveFailed(_ error)                     {}
+func (NoopDisplayer) IDTokenRejected(_ error)                     {}
 func (NoopDisplayer) Verifying()                                  {}
 func (NoopDisplayer) VerifyOK(_ string)                           {}
 func (NoopDisplayer) VerifyFailed(_ error)                        {}
+func (NoopDisplayer) Introspected(_ Introspection)                {}
 func (NoopDisplayer) APICallOK()                                  {}
 func (NoopDisplayer) APICallFailed(_ error)                       {}
 func (NoopDisplayer) AccessTokenRejected()                        {}
@@ -220,6 +284,10 @@ func (t *ProgramDisplayer) TokensNotFound() {
 	t.p.Send(MsgTokensNotFound{})
 }
 
+func (t *ProgramDisplayer) ScopeMissing(missing []string) {
+	t.p.Send(MsgScopeMissing{Missing: missing})
+}
+
 func (t *ProgramDisplayer) Refreshing() {
 	t.p.Send(MsgRefreshing{})
 }
@@ -264,6 +332,10 @@ func (t *ProgramDisplayer) TokenSaveFailed(err error) {
 	t.p.Send(MsgTokenSaveFailed{Err: err})
 }
 
+func (t *ProgramDisplayer) IDTokenRejected(err error) {
+	t.p.Send(MsgIDTokenRejected{Err: err})
+}
+
 func (t *ProgramDisplayer) Verifying() {
 	t.p.Send(MsgVerifying{})
 }
@@ -276,6 +348,10 @@ func (t *ProgramDisplayer) VerifyFailed(err error) {
 	t.p.Send(MsgVerifyFailed{Err: err})
 }
 
+func (t *ProgramDisplayer) Introspected(info Introspection) {
+	t.p.Send(MsgIntrospected{Info: info})
+}
+
 func (t *ProgramDisplayer) APICallOK() {
 	t.p.Send(MsgAPICallOK{})
 }
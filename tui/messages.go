@@ -19,6 +19,11 @@ type MsgTokenExpired struct{}
 // MsgTokensNotFound signals that no tokens were found (starting fresh).
 type MsgTokensNotFound struct{}
 
+// MsgScopeMissing signals that the saved token lacks requested scopes.
+type MsgScopeMissing struct {
+	Missing []string
+}
+
 // MsgRefreshing signals that a token refresh is in progress.
 type MsgRefreshing struct{}
 
@@ -51,6 +56,10 @@ type MsgTokenSaved struct{ Path string }
 // MsgTokenSaveFailed signals that saving tokens failed.
 type MsgTokenSaveFailed struct{ Err error }
 
+// MsgIDTokenRejected signals that an ID token failed verification and was
+// not saved.
+type MsgIDTokenRejected struct{ Err error }
+
 // MsgVerifying signals that token verification is in progress.
 type MsgVerifying struct{}
 
@@ -60,6 +69,9 @@ type MsgVerifyOK struct{ Body string }
 // MsgVerifyFailed signals that token verification failed.
 type MsgVerifyFailed struct{ Err error }
 
+// MsgIntrospected signals that the server reported the state of a token.
+type MsgIntrospected struct{ Info Introspection }
+
 // MsgAPICallOK signals that an API call succeeded.
 type MsgAPICallOK struct{}
 
@@ -8,6 +8,7 @@ import (
 	"charm.land/bubbles/v2/spinner"
 	tea "charm.land/bubbletea/v2"
 	"charm.land/lipgloss/v2"
+	"charm.land/lipgloss/v2/table"
 )
 
 // tickMsg is fired every second to update the countdown timer.
@@ -17,13 +18,14 @@ type tickMsg time.Time
 type state int
 
 const (
-	stateInit       state = iota
-	stateRefreshing       // refreshing existing token
-	stateDeviceFlow       // device code received, showing to user
-	statePolling          // waiting for user authorization
-	stateVerifying        // verifying token with server
-	stateSuccess          // all done
-	stateError            // fatal error
+	stateInit         state = iota
+	stateRefreshing         // refreshing existing token
+	stateDeviceFlow         // device code received, showing to user
+	statePolling            // waiting for user authorization
+	stateVerifying          // verifying token with server
+	stateSuccess            // all done
+	stateIntrospected       // token introspection result
+	stateError              // fatal error
 )
 
 // statusKind distinguishes line types in the status log.
@@ -56,10 +58,11 @@ type Model struct {
 	remaining         time.Duration
 
 	// Success / error display
-	tokenPreview string
-	tokenType    string
-	expiresIn    time.Duration
-	errMsg       string
+	tokenPreview  string
+	tokenType     string
+	expiresIn     time.Duration
+	errMsg        string
+	introspection Introspection
 
 	// Scrolling status log shown below the main panel
 	statusLines []statusLine
@@ -153,6 +156,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.addStatus(statusInfo, "No existing tokens, starting device flow")
 		return m, nil
 
+	case MsgScopeMissing:
+		m.addStatus(
+			statusWarn,
+			fmt.Sprintf(
+				"Token lacks scope %q, starting device flow",
+				strings.Join(msg.Missing, " "),
+			),
+		)
+		return m, nil
+
 	case MsgRefreshing:
 		m.state = stateRefreshing
 		m.addStatus(statusInfo, "Refreshing access token...")
@@ -199,6 +212,10 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.addStatus(statusWarn, fmt.Sprintf("Warning: failed to save tokens: %v", msg.Err))
 		return m, nil
 
+	case MsgIDTokenRejected:
+		m.addStatus(statusWarn, fmt.Sprintf("Warning: ID token not saved: %v", msg.Err))
+		return m, nil
+
 	case MsgVerifying:
 		m.state = stateVerifying
 		m.addStatus(statusInfo, "Verifying token...")
@@ -219,6 +236,11 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.addStatus(statusWarn, fmt.Sprintf("Token verification failed: %v", msg.Err))
 		return m, nil
 
+	case MsgIntrospected:
+		m.introspection = msg.Info
+		m.state = stateIntrospected
+		return m, nil
+
 	case MsgAPICallOK:
 		m.addStatus(statusOK, "API call successful")
 		return m, nil
@@ -262,6 +284,8 @@ func (m Model) View() tea.View {
 		return tea.NewView(m.viewSuccess())
 	case stateError:
 		return tea.NewView(m.viewError())
+	case stateIntrospected:
+		return tea.NewView(m.viewIntrospection())
 	default:
 		return tea.NewView(m.viewMain())
 	}
@@ -338,6 +362,39 @@ func (m Model) viewSuccess() string {
 	return b.String()
 }
 
+// viewIntrospection shows the introspected token fields as a table.
+func (m Model) viewIntrospection() string {
+	var b strings.Builder
+
+	b.WriteString("\n")
+	if m.introspection.Active {
+		b.WriteString(styleOK.Render("  ✓ Token is active"))
+	} else {
+		b.WriteString(styleErr.Render("  ✗ Token is not active"))
+	}
+	b.WriteString("\n\n")
+
+	rows := m.introspection.Rows()
+	t := table.New().
+		Border(lipgloss.RoundedBorder()).
+		BorderStyle(styleDim).
+		StyleFunc(func(row, col int) lipgloss.Style {
+			style := lipgloss.NewStyle().Padding(0, 1)
+			if col == 0 {
+				return style.Bold(true)
+			}
+			return style
+		})
+	for _, row := range rows {
+		t.Row(row[0], row[1])
+	}
+	b.WriteString(t.Render())
+	b.WriteString("\n")
+
+	b.WriteString(m.viewStatusLog())
+	return b.String()
+}
+
 // viewError is shown when a fatal error occurs.
 func (m Model) viewError() string {
 	var b strings.Builder
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/go-authgate/device-cli/authgate"
+	"github.com/go-authgate/device-cli/tui"
+)
+
+// timeClaims are the ID token claims holding seconds since the epoch.
+var timeClaims = []string{"exp", "iat", "nbf", "auth_time", "updated_at"}
+
+// cmdWhoami verifies the ID token saved with the current client's tokens and
+// prints its claims, or with -json the claims as a JSON object. The tokens are
+// refreshed first if they are about to expire, which also renews the ID token
+// on servers that issue one with every refresh. An ID token that has expired
+// anyway is renewed with one more refresh, and if the server does not issue a
+// new one the claims the introspection endpoint reports for the access token
+// are printed instead.
+func cmdWhoami(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("whoami", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "Print the verified claims as JSON")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if !noArgs("whoami", flags.Args()) {
+		return exitUsage
+	}
+
+	storage, err := freshToken(ctx, refreshAhead)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCodeFor(err)
+	}
+	if storage.IDToken == "" {
+		fmt.Fprintf(
+			os.Stderr,
+			"Error: no ID token saved for client_id %s; log in with the %q scope\n",
+			clientID, authgate.ScopeOpenID,
+		)
+		return exitNeedsLogin
+	}
+
+	if idTokenExpired(storage) && storage.RefreshToken != "" {
+		err = withDisplayer(func(d tui.Displayer) error {
+			refreshed, err := refreshAccessToken(ctx, storage.RefreshToken, d)
+			if err != nil {
+				return err
+			}
+			storage = refreshed
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitCodeFor(err)
+		}
+	}
+	if storage.IDToken == "" || idTokenExpired(storage) {
+		return whoamiIntrospect(ctx, storage, *asJSON)
+	}
+
+	idToken, err := newClient().VerifyIDToken(ctx, storage.IDToken, "", storage.ClockSkew)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCodeFor(err)
+	}
+	return printClaims(idToken.Claims, *asJSON)
+}
+
+// idTokenExpired reports whether the exp claim of the saved ID token has
+// passed on the server's clock. A token that cannot be parsed is left for
+// VerifyIDToken to reject.
+func idTokenExpired(storage *TokenStorage) bool {
+	t, err := authgate.ParseJWT(storage.IDToken)
+	if err != nil {
+		return false
+	}
+	exp, ok := t.Expiry()
+	return ok && time.Now().Add(storage.ClockSkew).After(exp)
+}
+
+// whoamiIntrospect prints the claims the server's introspection endpoint
+// reports for the access token, for servers that let the ID token expire.
+func whoamiIntrospect(ctx context.Context, storage *TokenStorage, asJSON bool) int {
+	fmt.Fprintln(
+		os.Stderr,
+		"The ID token has expired and was not renewed; showing the access token's introspection",
+	)
+	info, err := newClient().Introspect(
+		ctx, storage.AccessToken, authgate.TokenTypeHintAccessToken,
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCodeFor(err)
+	}
+	if !info.Active {
+		fmt.Fprintln(os.Stderr, "Error: the access token is not active; log in again")
+		return exitTokenInactive
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	var claims map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&claims); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	return printClaims(claims, asJSON)
+}
+
+// printClaims prints claims one per line, or as a JSON object with asJSON.
+func printClaims(claims map[string]any, asJSON bool) int {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(claims); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+
+	names := slices.Sorted(maps.Keys(claims))
+	width := len(slices.MaxFunc(names, func(a, b string) int { return len(a) - len(b) }))
+	for _, name := range names {
+		fmt.Printf("%-*s  %s\n", width+1, name+":", formatClaim(name, claims[name]))
+	}
+	return exitOK
+}
+
+// formatClaim renders a claim value for display: strings as they are,
+// timestamps as local times and anything else as JSON.
+func formatClaim(name string, value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		if seconds, err := v.Int64(); err == nil && slices.Contains(timeClaims, name) {
+			return time.Unix(seconds, 0).Local().Format(time.RFC3339)
+		}
+		return v.String()
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
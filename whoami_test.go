@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// signIDToken returns an RS256 ID token with claims, signed by key as kid.
+func signIDToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestCmdWhoami(t *testing.T) {
+	origServerURL, origClientID, origTokenFile := serverURL, clientID, tokenFile
+	defer func() {
+		serverURL = origServerURL
+		clientID = origClientID
+		tokenFile = origTokenFile
+	}()
+	tokenFile = filepath.Join(t.TempDir(), "tokens.json")
+	clientID = "test-client-whoami"
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var refreshes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/jwks.json":
+			b64 := base64.RawURLEncoding.EncodeToString
+			_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+				"kty": "RSA", "kid": "key-1",
+				"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+			}}})
+		case "/oauth/token":
+			// The server issues no new ID token on refresh.
+			refreshes.Add(1)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "whoami-refreshed-token", "token_type": "Bearer",
+				"expires_in": 3600, "refresh_token": "whoami-refresh-token",
+			})
+		case "/oauth/introspect":
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"active": r.FormValue("token") == "whoami-refreshed-token",
+				"sub":    "user-1", "client_id": clientID,
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	serverURL = server.URL
+
+	issuedAt := time.Now().Truncate(time.Second)
+	storage := &TokenStorage{
+		AccessToken:  "whoami-access-token",
+		RefreshToken: "whoami-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}
+	if err := saveTokens(storage); err != nil {
+		t.Fatalf("saveTokens() error = %v", err)
+	}
+
+	var code int
+	withStdio(t, "", func() {
+		code = cmdWhoami(context.Background(), nil)
+	})
+	if code != exitNeedsLogin {
+		t.Errorf("whoami without an ID token exited %d, want %d", code, exitNeedsLogin)
+	}
+
+	storage.IDToken = signIDToken(t, key, "key-1", map[string]any{
+		"iss":   server.URL,
+		"sub":   "user-1",
+		"aud":   clientID,
+		"exp":   issuedAt.Add(time.Hour).Unix(),
+		"iat":   issuedAt.Unix(),
+		"email": "user@example.com",
+	})
+	if err := saveTokens(storage); err != nil {
+		t.Fatalf("saveTokens() error = %v", err)
+	}
+
+	out := withStdio(t, "", func() {
+		code = cmdWhoami(context.Background(), []string{"-json"})
+	})
+	if code != exitOK {
+		t.Fatalf("whoami -json exited %d", code)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal([]byte(out), &claims); err != nil {
+		t.Fatalf("whoami -json wrote %q: %v", out, err)
+	}
+	if claims["sub"] != "user-1" || claims["email"] != "user@example.com" {
+		t.Errorf("whoami -json = %v, want the token's claims", claims)
+	}
+
+	out = withStdio(t, "", func() {
+		code = cmdWhoami(context.Background(), nil)
+	})
+	wantLine := "iat:    " + issuedAt.Local().Format(time.RFC3339) + "\n"
+	if code != exitOK || !strings.Contains(out, "sub:    user-1\n") ||
+		!strings.Contains(out, wantLine) {
+		t.Errorf("whoami = %d, %q", code, out)
+	}
+
+	// A token signed for another client is rejected.
+	storage.IDToken = signIDToken(t, key, "key-1", map[string]any{
+		"iss": server.URL, "sub": "user-1", "aud": "other-client",
+		"exp": issuedAt.Add(time.Hour).Unix(), "iat": issuedAt.Unix(),
+	})
+	if err := saveTokens(storage); err != nil {
+		t.Fatalf("saveTokens() error = %v", err)
+	}
+	out = withStdio(t, "", func() {
+		code = cmdWhoami(context.Background(), nil)
+	})
+	if code != exitError || out != "" {
+		t.Errorf("whoami with a foreign ID token = %d, %q; want %d", code, out, exitError)
+	}
+
+	// An expired ID token that a refresh does not renew falls back to
+	// introspecting the access token.
+	storage.IDToken = signIDToken(t, key, "key-1", map[string]any{
+		"iss": server.URL, "sub": "user-1", "aud": clientID,
+		"exp": issuedAt.Add(-time.Hour).Unix(), "iat": issuedAt.Add(-2 * time.Hour).Unix(),
+	})
+	if err := saveTokens(storage); err != nil {
+		t.Fatalf("saveTokens() error = %v", err)
+	}
+	out = withStdio(t, "", func() {
+		code = cmdWhoami(context.Background(), nil)
+	})
+	if code != exitOK || refreshes.Load() != 1 || !strings.Contains(out, "sub:        user-1\n") {
+		t.Errorf("whoami with an expired ID token = %d after %d refreshes, %q",
+			code, refreshes.Load(), out)
+	}
+}